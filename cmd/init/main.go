@@ -3,26 +3,42 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"time"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/pigeon-as/pigeon-init/internal/api"
 	"github.com/pigeon-as/pigeon-init/internal/boot"
+	"github.com/pigeon-as/pigeon-init/internal/cgroup"
+	"github.com/pigeon-as/pigeon-init/internal/clock"
 	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/entropy"
 	"github.com/pigeon-as/pigeon-init/internal/etc"
+	"github.com/pigeon-as/pigeon-init/internal/health"
+	"github.com/pigeon-as/pigeon-init/internal/kmod"
+	"github.com/pigeon-as/pigeon-init/internal/memory"
 	"github.com/pigeon-as/pigeon-init/internal/netcfg"
 	"github.com/pigeon-as/pigeon-init/internal/process"
+	"github.com/pigeon-as/pigeon-init/internal/render"
 	"github.com/pigeon-as/pigeon-init/internal/shutdown"
+	"github.com/pigeon-as/pigeon-init/internal/swap"
+	"github.com/pigeon-as/pigeon-init/internal/sysctl"
 	"github.com/pigeon-as/pigeon-init/internal/user"
 )
 
 const configPath = "/pigeon/run.json"
 const mmdsTimeout = 3 * time.Second
+const sidecarStopTimeout = 10 * time.Second
 
 func main() {
+	if process.IsChild() {
+		process.ChildMain()
+	}
+
 	if err := boot.MountDev(); err != nil {
 		fatal("mount dev", err)
 	}
@@ -36,6 +52,11 @@ func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
 	slog.SetDefault(logger)
 
+	// The kernel passes unrecognized command line parameters as env. Init
+	// keeps only a default PATH; processes get the workload env explicitly.
+	os.Clearenv()
+	os.Setenv("PATH", process.DefaultPath)
+
 	logger.Info("pigeon-init starting")
 
 	cfg, err := loadConfig(logger)
@@ -43,6 +64,24 @@ func main() {
 		fatal("load config", err)
 	}
 
+	if len(cfg.EntropySeed) > 0 {
+		before, after, err := entropy.Seed(cfg.EntropySeed)
+		if err != nil {
+			logger.Warn("seed entropy failed", "err", err)
+		} else {
+			logger.Info("seeded entropy", "bytes", len(cfg.EntropySeed), "entropy_before", before, "entropy_after", after)
+		}
+		clear(cfg.EntropySeed)
+	}
+
+	if cfg.Clock != nil && cfg.Clock.Time != nil {
+		if err := clock.Set(*cfg.Clock.Time); err != nil {
+			logger.Warn("set clock failed", "err", err)
+		} else {
+			logger.Info("clock set from host", "time", cfg.Clock.Time.UTC())
+		}
+	}
+
 	if err := boot.MountRootfs(cfg.RootDev()); err != nil {
 		fatal("mount rootfs", err)
 	}
@@ -57,57 +96,241 @@ func main() {
 	if err := boot.MountEssential(); err != nil {
 		fatal("mount essential", err)
 	}
-	if err := boot.MountCgroups(logger); err != nil {
+	initOOMScoreAdj := -1000
+	if cfg.InitOOMScoreAdj != nil {
+		initOOMScoreAdj = *cfg.InitOOMScoreAdj
+	}
+	if err := process.SetOOMScoreAdj(initOOMScoreAdj); err != nil {
+		logger.Warn("set init oom_score_adj failed", "err", err)
+	}
+	for name, err := range kmod.Load(cfg.KernelModules, logger) {
+		logger.Warn("load kernel module failed", "module", name, "err", err)
+	}
+	delegate := cfg.HasResources()
+	if err := boot.MountCgroups(delegate, logger); err != nil {
 		fatal("mount cgroups", err)
 	}
+	if delegate {
+		cgroup.EnableControllers(logger)
+	}
+	workloadCgroup := setupCgroup("workload", cfg.Resources, logger)
+	execCgroup := setupCgroup("exec", cfg.ExecResources, logger)
+
+	sysctlPolicy := sysctl.DefaultPolicy
+	if p := cfg.SysctlPolicy; p != nil {
+		if p.Allow != nil {
+			sysctlPolicy.Allow = p.Allow
+		}
+		if p.Deny != nil {
+			sysctlPolicy.Deny = p.Deny
+		}
+	}
+	for key, err := range sysctl.Apply(cfg.Sysctls, sysctlPolicy) {
+		logger.Warn("set sysctl failed", "key", key, "err", err)
+	}
 
 	if err := boot.SetRlimits(); err != nil {
 		logger.Warn("set rlimits failed", "err", err)
 	}
+	rlimits, err := process.ParseRlimits(cfg.Rlimits)
+	if err != nil {
+		fatal("parse rlimits", err)
+	}
+	security, err := process.ParseSecurity(cfg.Security)
+	if err != nil {
+		fatal("parse security", err)
+	}
+	sched, err := process.ParseScheduling(cfg.Scheduling)
+	if err != nil {
+		fatal("parse scheduling", err)
+	}
+	execSched, err := process.ParseScheduling(cfg.ExecScheduling)
+	if err != nil {
+		fatal("parse exec scheduling", err)
+	}
+	umask, err := parseUmask(cfg.Umask)
+	if err != nil {
+		fatal("parse umask", err)
+	}
+
+	procs, err := process.Order(cfg.Processes)
+	if err != nil {
+		fatal("parse processes", err)
+	}
+	var mainProc config.Process
+	for _, p := range procs {
+		if p.Main {
+			mainProc = p
+		}
+	}
+	restartConfig := cfg.Restart
+	if mainProc.Restart != nil {
+		restartConfig = mainProc.Restart
+	}
+	restart, err := process.ParseRestartPolicy(restartConfig)
+	if err != nil {
+		fatal("parse restart policy", err)
+	}
 
 	userSpec := "root"
-	if cfg.UserOverride != nil {
+	if mainProc.User != "" {
+		userSpec = mainProc.User
+	} else if cfg.UserOverride != nil {
 		userSpec = *cfg.UserOverride
 	} else if cfg.ImageConfig != nil && cfg.ImageConfig.User != "" {
 		userSpec = cfg.ImageConfig.User
 	}
-	identity, err := user.Resolve(userSpec)
+	if cfg.CreateUser {
+		if err := user.Ensure(userSpec); err != nil {
+			fatal("create user", err)
+		}
+	}
+	identity, err := user.Resolve(userSpec, cfg.ExtraGroups)
 	if err != nil {
 		fatal("resolve user", err)
 	}
-	logger.Info("resolved user", "uid", identity.UID, "gid", identity.GID, "home", identity.HomeDir)
+	logger.Info("resolved user", "uid", identity.UID, "gid", identity.GID, "groups", identity.Groups, "home", identity.HomeDir)
 
 	var imageEntrypoint, imageCmd, imageEnv []string
-	var workDir string
+	var workDir, stopSignal string
+	var volumes map[string]struct{}
+	var healthcheck *config.Healthcheck
 	if cfg.ImageConfig != nil {
 		imageEntrypoint = cfg.ImageConfig.Entrypoint
 		imageCmd = cfg.ImageConfig.Cmd
 		imageEnv = cfg.ImageConfig.Env
 		workDir = cfg.ImageConfig.WorkingDir
+		stopSignal = cfg.ImageConfig.StopSignal
+		volumes = cfg.ImageConfig.Volumes
+		healthcheck = cfg.ImageConfig.Healthcheck
+	}
+	if mainProc.WorkingDir != "" {
+		workDir = mainProc.WorkingDir
 	}
 
-	env := api.BuildEnv(imageEnv, cfg.ExtraEnv, identity.HomeDir)
+	initEnv := make(map[string]string)
+	tz, err := etc.SetTimezone(cfg.Timezone)
+	if err != nil {
+		logger.Warn("set timezone failed", "err", err)
+	} else if tz != "" {
+		initEnv["TZ"] = tz
+	}
+	certFile, err := etc.InstallCACertificates(cfg.CACertificates)
+	if err != nil {
+		logger.Warn("install CA certificates failed", "err", err)
+	} else if certFile != "" {
+		initEnv["SSL_CERT_FILE"] = certFile
+	}
 
-	for _, e := range env {
-		if len(e) > 5 && e[:5] == "PATH=" {
-			os.Setenv("PATH", e[5:])
-			break
+	if cfg.MetadataEnv {
+		prefix := api.DefaultMetadataPrefix
+		if cfg.MetadataEnvPrefix != nil {
+			prefix = *cfg.MetadataEnvPrefix
+		}
+		for k, v := range api.ReadMetadata(cfg).Env(prefix) {
+			initEnv[k] = v
 		}
 	}
 
-	argv := api.BuildArgv(cfg.ExecOverride, imageEntrypoint, imageCmd, cfg.CmdOverride)
+	env := api.BuildEnv(imageEnv, initEnv, mergeEnv(cfg.ExtraEnv, mainProc.Env), identity.HomeDir)
+
+	var cmdOverride []string
+	if cfg.CmdOverride != nil {
+		cmdOverride, err = api.ParseCmdOverride(*cfg.CmdOverride, cfg.CmdOverrideMode, cfg.Shell)
+		if err != nil {
+			fatal("parse CmdOverride", err)
+		}
+	}
+	argv := api.BuildArgv(cfg.ExecOverride, imageEntrypoint, imageCmd, cmdOverride)
+	if len(mainProc.Cmd) > 0 {
+		argv = mainProc.Cmd
+	}
 	if len(argv) == 0 {
 		fatal("empty argv: no command configured", nil)
 	}
 
-	sup, err := process.New(argv, env, workDir, identity, logger)
+	workloadSpec := process.Spec{
+		Env:      env,
+		WorkDir:  workDir,
+		Identity: identity,
+		Cgroup:   workloadCgroup,
+		Rlimits:  rlimits,
+		Security: security,
+		Sched:    sched,
+		Umask:    umask,
+
+		CreateWorkDir: cfg.CreateWorkingDir,
+		Namespaces:    workloadNamespaces(cfg),
+		Filesystem:    cfg.Filesystem,
+	}
+	sup, err := process.New(argv, workloadSpec, logger)
 	if err != nil {
 		fatal("create supervisor", err)
 	}
+	if stopSignal != "" {
+		sig, err := process.ParseSignal(stopSignal)
+		if err != nil {
+			fatal("parse stop signal", err)
+		}
+		sup.StopSignal = sig
+	}
+	sup.Restart = restart
 
-	apiServer := api.NewServer(sup, env, logger)
+	// Sidecars run like the workload but in init's namespaces. Those
+	// ordered before the main process start before it.
+	afterMain := false
+	for _, p := range procs {
+		if p.Main {
+			afterMain = true
+			continue
+		}
+		sc, err := sidecar(p, cfg, workloadSpec, imageEnv, initEnv, workDir, logger)
+		if err != nil {
+			fatal("configure process "+p.Name, err)
+		}
+		sc.AfterMain = afterMain
+		sup.AddSidecar(sc)
+	}
+
+	// Healthchecks run like the workload, entering its namespaces per probe.
+	healthSpec := workloadSpec
+	healthSpec.CreateWorkDir = false
+	healthSpec.Namespaces, healthSpec.Filesystem = nil, nil
+	checker, err := health.NewChecker(healthcheck, sup, healthSpec, logger)
+	if err != nil {
+		fatal("parse healthcheck", err)
+	}
+
+	execSpec := process.Spec{Env: env, Cgroup: execCgroup, Sched: execSched}
+	if cfg.ExecRlimits {
+		execSpec.Rlimits = rlimits
+	}
+	if cfg.ExecSecurity {
+		execSpec.Security = security
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+
+	var syncer *clock.Syncer
+	if cfg.Clock != nil && cfg.Clock.PTPDevice != "" {
+		syncer = clock.NewSyncer(cfg.Clock.PTPDevice, time.Duration(cfg.Clock.SyncInterval)*time.Second, logger)
+		go func() {
+			if err := syncer.Run(ctx); err != nil {
+				logger.Warn("clock sync stopped", "err", err)
+			}
+		}()
+	}
+
+	if cfg.MemoryHotplug != nil {
+		go func() {
+			if err := memory.Watch(ctx, cfg.MemoryHotplug.Policy, logger); err != nil {
+				logger.Warn("memory hotplug watcher stopped", "err", err)
+			}
+		}()
+	}
+
+	renderer := render.New(env, identity.UID, identity.GID, logger)
+	apiServer := api.NewServer(sup, execSpec, syncer, checker, renderer, logger)
 	go func() {
 		if err := apiServer.Serve(ctx); err != nil {
 			logger.Warn("vsock API error", "err", err)
@@ -118,6 +341,27 @@ func main() {
 		fatal("mount extra", err)
 	}
 
+	var mounts []string
+	for _, m := range cfg.Mounts {
+		mounts = append(mounts, m.MountPath)
+	}
+	var skipVolumes []string
+	if cfg.Filesystem != nil {
+		for _, w := range cfg.Filesystem.WritablePaths {
+			skipVolumes = append(skipVolumes, w.Path)
+		}
+	}
+	volumeMounts, err := boot.MountVolumes(volumes, append(skipVolumes, mounts...), identity.UID, identity.GID)
+	if err != nil {
+		fatal("mount volumes", err)
+	}
+	mounts = append(mounts, volumeMounts...)
+
+	swaps, err := swap.Enable(cfg.Swap, logger)
+	if err != nil {
+		logger.Warn("enable swap failed", "err", err)
+	}
+
 	if err := etc.SetHostname(cfg.Hostname); err != nil {
 		logger.Warn("set hostname failed", "err", err)
 	}
@@ -132,14 +376,23 @@ func main() {
 		fatal("configure network", err)
 	}
 
+	if _, err := renderer.Render(cfg); err != nil {
+		fatal("render templates", err)
+	}
+
 	if err := sup.Start(); err != nil {
 		fatal("start workload", err)
 	}
 
+	if checker != nil {
+		go checker.Run(ctx)
+	}
+
 	result := sup.Run()
+	sup.StopSidecars(sidecarStopTimeout)
 
-	logger.Info("workload exited", "exit_code", result.ExitCode, "oom_killed", result.OOMKilled)
-	shutdown.Shutdown(cfg.Mounts, logger)
+	logger.Info("workload exited", "exit_code", result.ExitCode, "oom_killed", result.OOMKilled, "restarts", result.RestartCount)
+	shutdown.Shutdown(mounts, swaps, logger)
 	cancel()
 }
 
@@ -163,6 +416,95 @@ func loadConfig(logger *slog.Logger) (*config.RunConfig, error) {
 	return cfg, nil
 }
 
+// workloadNamespaces returns the workload's namespaces. Filesystem hardening
+// always happens in a private mount namespace so it never restricts init.
+func workloadNamespaces(cfg *config.RunConfig) *config.Namespaces {
+	if cfg.Filesystem == nil || cfg.Namespaces.NewMount() {
+		return cfg.Namespaces
+	}
+	var ns config.Namespaces
+	if cfg.Namespaces != nil {
+		ns = *cfg.Namespaces
+	}
+	ns.Mount = true
+	return &ns
+}
+
+// sidecar builds the sidecar for a non-main process entry, based on the
+// workload's spec. Each sidecar gets its own cgroup, so neither its usage
+// nor its OOM kills are accounted to the workload.
+func sidecar(p config.Process, cfg *config.RunConfig, base process.Spec, imageEnv []string, initEnv map[string]string, workDir string, logger *slog.Logger) (process.Sidecar, error) {
+	restart, err := process.ParseRestartPolicy(p.Restart)
+	if err != nil {
+		return process.Sidecar{}, err
+	}
+	identity := base.Identity
+	if p.User != "" {
+		if cfg.CreateUser {
+			if err := user.Ensure(p.User); err != nil {
+				return process.Sidecar{}, fmt.Errorf("create user: %w", err)
+			}
+		}
+		identity, err = user.Resolve(p.User, cfg.ExtraGroups)
+		if err != nil {
+			return process.Sidecar{}, fmt.Errorf("resolve user: %w", err)
+		}
+	}
+	spec := base
+	spec.Env = api.BuildEnv(imageEnv, initEnv, mergeEnv(cfg.ExtraEnv, p.Env), identity.HomeDir)
+	spec.Identity = identity
+	spec.WorkDir = workDir
+	if p.WorkingDir != "" {
+		spec.WorkDir = p.WorkingDir
+	}
+	spec.CreateWorkDir = false
+	spec.Namespaces, spec.Filesystem = nil, nil
+	spec.Cgroup = setupCgroup("sidecar-"+p.Name, p.Resources, logger)
+	return process.Sidecar{Name: p.Name, Argv: p.Cmd, Spec: spec, Restart: restart}, nil
+}
+
+// mergeEnv returns base with over applied on top.
+func mergeEnv(base, over map[string]string) map[string]string {
+	if len(over) == 0 {
+		return base
+	}
+	out := make(map[string]string, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		out[k] = v
+	}
+	return out
+}
+
+// parseUmask parses an octal umask. Empty means init's is inherited.
+func parseUmask(s string) (*int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0777 {
+		return nil, fmt.Errorf("invalid umask %q", s)
+	}
+	mask := int(v)
+	return &mask, nil
+}
+
+// setupCgroup creates a child cgroup and applies res. Returns nil if the
+// cgroup can't be created so the process is spawned in the root cgroup.
+func setupCgroup(name string, res *config.Resources, logger *slog.Logger) *cgroup.Group {
+	g, err := cgroup.New(name)
+	if err != nil {
+		logger.Warn("create cgroup failed", "cgroup", name, "err", err)
+		return nil
+	}
+	if err := g.Set(res); err != nil {
+		logger.Warn("set cgroup limits failed", "cgroup", name, "err", err)
+	}
+	return g
+}
+
 func setupConsole() {
 	fd, err := unix.Open("/dev/ttyS0", unix.O_RDWR, 0)
 	if err != nil {
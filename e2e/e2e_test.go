@@ -248,3 +248,156 @@ func TestWorkDir(t *testing.T) {
 		ExecOverride: sh(`test "$(pwd)" = "/tmp"`),
 	})
 }
+
+func TestCgroup_Workload(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Resources:    &config.Resources{MemoryMax: 128 << 20, PidsMax: 256},
+		ExecOverride: sh(`grep -q "0::/workload" /proc/self/cgroup && test "$(cat /sys/fs/cgroup/unified/workload/pids.max)" = "256"`),
+	})
+}
+
+func TestRlimits(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Rlimits: map[string]config.Rlimit{
+			"nofile":  {Soft: 4096, Hard: 8192},
+			"memlock": {Soft: -1, Hard: -1},
+		},
+		ExecOverride: sh(`test "$(ulimit -n)" = "4096" && test "$(ulimit -l)" = "unlimited"`),
+	})
+}
+
+func TestSysctls(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Sysctls:      map[string]string{"net.core.somaxconn": "2048"},
+		ExecOverride: sh(`test "$(cat /proc/sys/net/core/somaxconn)" = "2048"`),
+	})
+}
+
+func TestTimezone(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Timezone:     "Asia/Tokyo",
+		ExecOverride: sh(`test -s /etc/localtime && test "$(date +%z)" = "+0900"`),
+	})
+}
+
+func TestUser_SupplementaryGroups(t *testing.T) {
+	user := "nobody"
+	bootWithRetry(t, &config.RunConfig{
+		UserOverride: &user,
+		ExtraGroups:  []string{"1234"},
+		ExecOverride: sh(`id -G | grep -qw 1234`),
+	})
+}
+
+func TestSecurity_AmbientCapabilities(t *testing.T) {
+	user := "nobody"
+	bootWithRetry(t, &config.RunConfig{
+		UserOverride: &user,
+		Security: &config.Security{
+			Capabilities:        []string{"CAP_NET_BIND_SERVICE"},
+			AmbientCapabilities: []string{"CAP_NET_BIND_SERVICE"},
+			NoNewPrivileges:     true,
+		},
+		ExecOverride: sh(`grep -q '^CapAmb:.*0000000000000400$' /proc/self/status && grep -q '^NoNewPrivs:.*1$' /proc/self/status`),
+	})
+}
+
+func TestSecurity_Seccomp(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Security: &config.Security{
+			Capabilities: []string{"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_SETUID", "CAP_SETGID"},
+			Seccomp:      &config.Seccomp{},
+		},
+		ExecOverride: sh(`grep -q '^Seccomp:.*2$' /proc/self/status`),
+	})
+}
+
+func TestFilesystem_ReadOnlyRoot(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Filesystem: &config.Filesystem{
+			ReadOnlyRoot:  true,
+			WritablePaths: []config.WritablePath{{Path: "/tmp"}},
+		},
+		ExecOverride: sh(`! touch /etc/x 2>/dev/null && touch /tmp/x && test ! -s /proc/kcore && ! echo 1 > /proc/sys/vm/overcommit_memory`),
+	})
+}
+
+func TestNamespaces(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Namespaces:   &config.Namespaces{PID: true, UTS: true},
+		ExecOverride: sh(`test "$PPID" = 1 && test "$(readlink /proc/1/ns/uts)" = "$(readlink /proc/self/ns/uts)"`),
+	})
+}
+
+func TestScheduling(t *testing.T) {
+	adj, nice := 500, 5
+	bootWithRetry(t, &config.RunConfig{
+		Scheduling:   &config.Scheduling{OOMScoreAdj: &adj, Nice: &nice},
+		ExecOverride: sh(`test "$(cat /proc/self/oom_score_adj)" = 500 && test "$(cat /proc/1/oom_score_adj)" = -1000`),
+	})
+}
+
+func TestUser_Create(t *testing.T) {
+	user := "4242"
+	bootWithRetry(t, &config.RunConfig{
+		UserOverride: &user,
+		CreateUser:   true,
+		ExecOverride: sh(`[ "$(whoami)" = user4242 ] && [ "$HOME" = /home/user4242 ] && [ -O "$HOME" ]`),
+	})
+}
+
+func TestImage_Volumes(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		ImageConfig: &config.ImageConfig{
+			Volumes: map[string]struct{}{"/data": {}},
+		},
+		ExecOverride: sh(`grep -q ' /data tmpfs ' /proc/mounts && touch /data/f`),
+	})
+}
+
+func TestCmdOverride_Words(t *testing.T) {
+	cmd := `-c '[ "$1" = "a b" ]' sh "a b"`
+	bootWithRetry(t, &config.RunConfig{
+		ImageConfig:     &config.ImageConfig{Entrypoint: []string{"/bin/sh"}},
+		CmdOverride:     &cmd,
+		CmdOverrideMode: "words",
+	})
+}
+
+func TestEnv_Metadata(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Hostname:     "meta-test",
+		VMID:         "vm-e2e",
+		MetadataEnv:  true,
+		ExecOverride: sh(`[ "$PIGEON_HOSTNAME" = meta-test ] && [ "$PIGEON_VM_ID" = vm-e2e ] && [ "$PIGEON_CPUS" -ge 1 ] && [ "$PIGEON_MEMORY_MB" -gt 0 ]`),
+	})
+}
+
+func TestTemplates(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Hostname:     "tmpl-test",
+		ExtraEnv:     map[string]string{"GREETING": "hello"},
+		Templates:    []config.Template{{Path: "/etc/greeting", Template: "{{.Env.GREETING}} from {{.Hostname}}", Mode: "0600"}},
+		ExecOverride: sh(`[ "$(cat /etc/greeting)" = "hello from tmpl-test" ] && [ "$(stat -c %a /etc/greeting)" = 600 ]`),
+	})
+}
+
+func TestProcesses_Sidecar(t *testing.T) {
+	bootWithRetry(t, &config.RunConfig{
+		Processes: []config.Process{
+			{Name: "writer", Cmd: sh(`echo ready >> /tmp/sidecar; sleep 60`)},
+			{Name: "app", Main: true, DependsOn: []string{"writer"}},
+		},
+		ExecOverride: sh(`for i in $(seq 50); do [ -s /tmp/sidecar ] && exit 0; sleep 0.1; done; exit 1`),
+	})
+}
+
+func TestRestart_OnFailure(t *testing.T) {
+	out := bootWithRetry(t, &config.RunConfig{
+		Restart:      &config.RestartPolicy{Policy: "on-failure", MaxRetries: 3},
+		ExecOverride: sh(`[ -e /tmp/ran ] && exit 0; touch /tmp/ran; exit 1`),
+	})
+	must.StrContains(t, out, "restarting workload")
+	must.StrContains(t, out, "exit_code=0")
+	must.StrContains(t, out, "restarts=1")
+}
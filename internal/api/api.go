@@ -1,21 +1,28 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
-	"os/exec"
+	"os"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/mdlayher/vsock"
+	"golang.org/x/sys/unix"
 
+	"github.com/pigeon-as/pigeon-init/internal/clock"
+	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/health"
+	"github.com/pigeon-as/pigeon-init/internal/memory"
 	"github.com/pigeon-as/pigeon-init/internal/process"
+	"github.com/pigeon-as/pigeon-init/internal/render"
+	"github.com/pigeon-as/pigeon-init/internal/user"
 )
 
 const (
@@ -24,15 +31,24 @@ const (
 
 type Server struct {
 	supervisor *process.Supervisor
-	env        []string
+	exec       process.Spec
+	clock      *clock.Syncer
+	health     *health.Checker
+	render     *render.Renderer
 	mux        *http.ServeMux
 	logger     *slog.Logger
 }
 
-func NewServer(sup *process.Supervisor, env []string, logger *slog.Logger) *Server {
+// NewServer creates the vsock API. Exec sessions are spawned per execSpec;
+// syncer and checker may be nil when clock sync or healthchecks are disabled.
+// renderer re-renders templates on config updates.
+func NewServer(sup *process.Supervisor, execSpec process.Spec, syncer *clock.Syncer, checker *health.Checker, renderer *render.Renderer, logger *slog.Logger) *Server {
 	s := &Server{
 		supervisor: sup,
-		env:        env,
+		exec:       execSpec,
+		clock:      syncer,
+		health:     checker,
+		render:     renderer,
 		mux:        http.NewServeMux(),
 		logger:     logger,
 	}
@@ -42,6 +58,10 @@ func NewServer(sup *process.Supervisor, env []string, logger *slog.Logger) *Serv
 	s.mux.HandleFunc("POST /v1/signals", s.handleSignal)
 	s.mux.HandleFunc("POST /v1/exec", s.handleExec)
 	s.mux.HandleFunc("GET /v1/ws/exec", s.handleExecWS)
+	s.mux.HandleFunc("GET /v1/clock", s.handleClock)
+	s.mux.HandleFunc("GET /v1/memory", s.handleMemory)
+	s.mux.HandleFunc("GET /v1/health", s.handleHealth)
+	s.mux.HandleFunc("PUT /v1/config", s.handleConfig)
 
 	return s
 }
@@ -72,7 +92,15 @@ func (s *Server) Serve(ctx context.Context) error {
 }
 
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	status := struct {
+		OK             bool   `json:"ok"`
+		RestartCount   int    `json:"restart_count"`
+		LastExitReason string `json:"last_exit_reason,omitempty"`
+	}{OK: true}
+	if s.supervisor != nil {
+		status.RestartCount, status.LastExitReason = s.supervisor.Restarts()
+	}
+	writeJSON(w, http.StatusOK, status)
 }
 
 func (s *Server) handleExitCode(w http.ResponseWriter, r *http.Request) {
@@ -86,6 +114,47 @@ func (s *Server) handleExitCode(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) handleClock(w http.ResponseWriter, r *http.Request) {
+	if s.clock == nil {
+		http.Error(w, "clock sync not enabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.clock.Status())
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if s.health == nil {
+		http.Error(w, "no healthcheck configured", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.health.Status())
+}
+
+// handleConfig takes an updated RunConfig and re-renders its templates.
+// Nothing else is applied and the config isn't saved.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	var cfg config.RunConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	rendered, err := s.render.Render(&cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"rendered": rendered})
+}
+
+func (s *Server) handleMemory(w http.ResponseWriter, r *http.Request) {
+	st, err := memory.ReadStat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
 func (s *Server) handleSignal(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Signal int `json:"signal"`
@@ -113,55 +182,138 @@ func (s *Server) handleSignal(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleExec(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Cmd []string `json:"cmd"`
+		Cmd          []string `json:"cmd"`
+		User         string   `json:"user,omitempty"`
+		JoinWorkload bool     `json:"join_workload,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Cmd) == 0 {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
+	spec, err := s.execSpecFor(req.User, req.JoinWorkload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	s.supervisor.Lock()
-	defer s.supervisor.Unlock()
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer stdoutR.Close()
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutW.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer stderrR.Close()
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
+	cmd := spec.Command(context.Background(), req.Cmd)
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	cmd.SysProcAttr.Setpgid = true
 
-	cmd := exec.CommandContext(ctx, req.Cmd[0], req.Cmd[1:]...)
-	cmd.Env = s.env
-	var stderrBuf bytes.Buffer
-	cmd.Stderr = &stderrBuf
-	stdout, err := cmd.Output()
+	// Spawn and register under the reap lock, then release it: holding it
+	// while the command runs would stall signal forwarding and restarts.
+	s.supervisor.Lock()
+	err = cmd.Start()
+	var exitCh <-chan unix.WaitStatus
+	if err == nil {
+		exitCh = s.supervisor.RegisterExec(cmd.Process.Pid)
+	}
+	s.supervisor.Unlock()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pid := cmd.Process.Pid
+	defer s.supervisor.UnregisterExec(pid)
 
-	var exitCode int
-	var exitSignal int
+	stdout, stderr := readAsync(stdoutR), readAsync(stderrR)
 
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-			if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
-				exitSignal = int(ws.Signal())
-			}
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	var ws unix.WaitStatus
+	select {
+	case ws = <-exitCh:
+	case <-ctx.Done():
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+		ws = <-exitCh
 	}
 
+	exitCode, exitSignal := ws.ExitStatus(), 0
+	if ws.Signaled() {
+		exitCode, exitSignal = -1, int(ws.Signal())
+	}
 	writeJSON(w, http.StatusOK, map[string]any{
 		"exit_code":   exitCode,
 		"exit_signal": exitSignal,
-		"stdout":      string(stdout),
-		"stderr":      stderrBuf.String(),
+		"stdout":      string(collect(stdout)),
+		"stderr":      string(collect(stderr)),
 	})
 }
 
+// readAsync reads r to EOF in the background.
+func readAsync(r io.Reader) <-chan []byte {
+	ch := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(r)
+		ch <- data
+	}()
+	return ch
+}
+
+// collect returns the output read by readAsync. Background processes may
+// hold the pipe open, so it gives up after a second.
+func collect(ch <-chan []byte) []byte {
+	select {
+	case data := <-ch:
+		return data
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// execSpecFor returns the exec session spec, running as userSpec
+// ("user[:group]") when set and as root otherwise. With join set the session
+// enters the workload's namespaces.
+func (s *Server) execSpecFor(userSpec string, join bool) (process.Spec, error) {
+	spec := s.exec
+	if join {
+		j, err := s.supervisor.Join()
+		if err != nil {
+			return spec, err
+		}
+		spec.Join = j
+	}
+	if userSpec == "" {
+		return spec, nil
+	}
+	if join {
+		// Resolved by the helper against the workload's /etc/passwd.
+		spec.User = userSpec
+		return spec, nil
+	}
+	identity, err := user.Resolve(userSpec, nil)
+	if err != nil {
+		return spec, err
+	}
+	spec.Identity = identity
+	return spec, nil
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
 
-func BuildArgv(execOverride []string, entrypoint []string, cmd []string, cmdOverride *string) []string {
+// BuildArgv returns execOverride if set, else entrypoint followed by
+// cmdOverride (see ParseCmdOverride) or, when that is nil, cmd.
+func BuildArgv(execOverride []string, entrypoint []string, cmd []string, cmdOverride []string) []string {
 	if len(execOverride) > 0 {
 		return execOverride
 	}
@@ -170,7 +322,7 @@ func BuildArgv(execOverride []string, entrypoint []string, cmd []string, cmdOver
 	argv = append(argv, entrypoint...)
 
 	if cmdOverride != nil {
-		argv = append(argv, *cmdOverride)
+		argv = append(argv, cmdOverride...)
 	} else {
 		argv = append(argv, cmd...)
 	}
@@ -178,7 +330,9 @@ func BuildArgv(execOverride []string, entrypoint []string, cmd []string, cmdOver
 	return argv
 }
 
-func BuildEnv(imageEnv []string, extraEnv map[string]string, homeDir string) []string {
+// BuildEnv merges the image env, variables init derives from config (TZ,
+// metadata, ...) and ExtraEnv, in increasing priority. HOME defaults to homeDir.
+func BuildEnv(imageEnv []string, initEnv map[string]string, extraEnv map[string]string, homeDir string) []string {
 	env := make(map[string]string)
 
 	for _, e := range imageEnv {
@@ -187,6 +341,10 @@ func BuildEnv(imageEnv []string, extraEnv map[string]string, homeDir string) []s
 		}
 	}
 
+	for k, v := range initEnv {
+		env[k] = v
+	}
+
 	for k, v := range extraEnv {
 		env[k] = v
 	}
@@ -3,7 +3,11 @@
 package api
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
 )
 
 func TestBuildArgv_ExecOverride(t *testing.T) {
@@ -24,7 +28,7 @@ func TestBuildArgv_EntrypointPlusCmd(t *testing.T) {
 
 func TestBuildArgv_EntrypointPlusCmdOverride(t *testing.T) {
 	override := "overridden"
-	got := BuildArgv(nil, []string{"/bin/entry"}, []string{"default"}, &override)
+	got := BuildArgv(nil, []string{"/bin/entry"}, []string{"default"}, []string{override})
 	want := []string{"/bin/entry", "overridden"}
 	if !sliceEqual(got, want) {
 		t.Errorf("BuildArgv entrypoint+cmdOverride: got %v, want %v", got, want)
@@ -44,7 +48,7 @@ func TestBuildArgv_ExecOverrideBeatsAll(t *testing.T) {
 		[]string{"/exec"},
 		[]string{"/entry"},
 		[]string{"cmd"},
-		&override,
+		[]string{override},
 	)
 	want := []string{"/exec"}
 	if !sliceEqual(got, want) {
@@ -55,6 +59,7 @@ func TestBuildArgv_ExecOverrideBeatsAll(t *testing.T) {
 func TestBuildEnv_MergesImageAndExtra(t *testing.T) {
 	got := BuildEnv(
 		[]string{"PATH=/usr/bin", "FOO=bar"},
+		nil,
 		map[string]string{"BAZ": "qux"},
 		"/home/test",
 	)
@@ -77,6 +82,7 @@ func TestBuildEnv_MergesImageAndExtra(t *testing.T) {
 func TestBuildEnv_ExtraOverridesImage(t *testing.T) {
 	got := BuildEnv(
 		[]string{"FOO=original"},
+		nil,
 		map[string]string{"FOO": "overridden"},
 		"/root",
 	)
@@ -90,6 +96,7 @@ func TestBuildEnv_HomeNotOverridden(t *testing.T) {
 	got := BuildEnv(
 		[]string{"HOME=/custom"},
 		nil,
+		nil,
 		"/default",
 	)
 	env := envToMap(got)
@@ -99,7 +106,7 @@ func TestBuildEnv_HomeNotOverridden(t *testing.T) {
 }
 
 func TestBuildEnv_HomeDefaulted(t *testing.T) {
-	got := BuildEnv(nil, nil, "/fallback")
+	got := BuildEnv(nil, nil, nil, "/fallback")
 	env := envToMap(got)
 	if env["HOME"] != "/fallback" {
 		t.Errorf("HOME default: got %q, want /fallback", env["HOME"])
@@ -110,6 +117,7 @@ func TestBuildEnv_MalformedImageEnv(t *testing.T) {
 	got := BuildEnv(
 		[]string{"NOEQUALS", "GOOD=value", "=empty_key"},
 		nil,
+		nil,
 		"/root",
 	)
 	env := envToMap(got)
@@ -125,13 +133,29 @@ func TestBuildEnv_MalformedImageEnv(t *testing.T) {
 }
 
 func TestBuildEnv_ValueWithEquals(t *testing.T) {
-	got := BuildEnv([]string{"DSN=postgres://host?opt=val"}, nil, "/root")
+	got := BuildEnv([]string{"DSN=postgres://host?opt=val"}, nil, nil, "/root")
 	env := envToMap(got)
 	if env["DSN"] != "postgres://host?opt=val" {
 		t.Errorf("value with equals: got %q", env["DSN"])
 	}
 }
 
+func TestBuildEnv_InitEnvPrecedence(t *testing.T) {
+	got := BuildEnv(
+		[]string{"TZ=UTC", "LANG=C"},
+		map[string]string{"TZ": "Europe/Paris", "LANG": "C.UTF-8"},
+		map[string]string{"TZ": "Asia/Tokyo"},
+		"/root",
+	)
+	env := envToMap(got)
+	if env["TZ"] != "Asia/Tokyo" {
+		t.Errorf("extra should override init env: got %q, want Asia/Tokyo", env["TZ"])
+	}
+	if env["LANG"] != "C.UTF-8" {
+		t.Errorf("init env should override image: got %q, want C.UTF-8", env["LANG"])
+	}
+}
+
 func TestParseEnvVar(t *testing.T) {
 	tests := []struct {
 		input string
@@ -180,3 +204,140 @@ func envToMap(env []string) map[string]string {
 	}
 	return m
 }
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"--port 9090 --verbose", []string{"--port", "9090", "--verbose"}},
+		{"  a\t b\n", []string{"a", "b"}},
+		{`--name 'hello world'`, []string{"--name", "hello world"}},
+		{`"a \"b\" \$c \x" 'd\e'`, []string{`a "b" $c \x`, `d\e`}},
+		{`a\ b c\\d`, []string{"a b", `c\d`}},
+		{`x"y"'z' "" ''`, []string{"xyz", "", ""}},
+		{"a\\\nb", []string{"ab"}},
+		{"$HOME | wc", []string{"$HOME", "|", "wc"}},
+		{"", []string{}},
+		{" \t\n", []string{}},
+	}
+	for _, tt := range tests {
+		got, err := SplitWords(tt.in)
+		if err != nil {
+			t.Errorf("SplitWords(%q): %v", tt.in, err)
+			continue
+		}
+		if !sliceEqual(got, tt.want) {
+			t.Errorf("SplitWords(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWords_Errors(t *testing.T) {
+	for in, want := range map[string]string{
+		`--name 'hello`: "unterminated single quote at offset 7",
+		`a "b`:          "unterminated double quote at offset 2",
+		`a\`:            "trailing backslash",
+	} {
+		_, err := SplitWords(in)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("SplitWords(%q): got %v, want error containing %q", in, err, want)
+		}
+	}
+}
+
+func TestParseCmdOverride(t *testing.T) {
+	tests := []struct {
+		mode  string
+		shell []string
+		want  []string
+	}{
+		{"", nil, []string{"serve --port 9090"}},
+		{CmdLiteral, nil, []string{"serve --port 9090"}},
+		{CmdWords, nil, []string{"serve", "--port", "9090"}},
+		{CmdShell, nil, []string{"/bin/sh", "-c", "serve --port 9090"}},
+		{CmdShell, []string{"/bin/bash", "-lc"}, []string{"/bin/bash", "-lc", "serve --port 9090"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCmdOverride("serve --port 9090", tt.mode, tt.shell)
+		if err != nil || !sliceEqual(got, tt.want) {
+			t.Errorf("ParseCmdOverride(mode %q): got %q, %v; want %q", tt.mode, got, err, tt.want)
+		}
+	}
+	if _, err := ParseCmdOverride("x", "split", nil); err == nil {
+		t.Error("unknown mode: expected error")
+	}
+}
+
+func TestParseCmdOverride_EmptyWords(t *testing.T) {
+	for _, s := range []string{"", "   "} {
+		over, err := ParseCmdOverride(s, CmdWords, nil)
+		if err != nil || over == nil || len(over) != 0 {
+			t.Fatalf("ParseCmdOverride(%q, words): got %#v, %v; want an empty override", s, over, err)
+		}
+		if got := BuildArgv(nil, []string{"/app"}, []string{"--default"}, over); !sliceEqual(got, []string{"/app"}) {
+			t.Errorf("BuildArgv with %q: got %q, want the image cmd dropped", s, got)
+		}
+	}
+}
+
+func TestMetadataEnv(t *testing.T) {
+	m := Metadata{
+		Hostname:   "web-1",
+		PrivateIP:  "10.0.0.2",
+		PrivateIPs: []string{"10.0.0.2", "fdaa::2"},
+		VMID:       "vm-abc",
+		MemoryMB:   512,
+		CPUs:       2,
+	}
+
+	got := m.Env(DefaultMetadataPrefix)
+	want := map[string]string{
+		"PIGEON_HOSTNAME":    "web-1",
+		"PIGEON_PRIVATE_IP":  "10.0.0.2",
+		"PIGEON_PRIVATE_IPS": "10.0.0.2,fdaa::2",
+		"PIGEON_VM_ID":       "vm-abc",
+		"PIGEON_MEMORY_MB":   "512",
+		"PIGEON_CPUS":        "2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Env: got %v, want %v", got, want)
+	}
+
+	got = Metadata{CPUs: 1}.Env("APP_")
+	if len(got) != 1 || got["APP_CPUS"] != "1" {
+		t.Errorf("Env with prefix and unknown values: got %v", got)
+	}
+}
+
+func TestMetadataEnv_ExtraEnvWins(t *testing.T) {
+	meta := Metadata{Hostname: "web-1"}.Env(DefaultMetadataPrefix)
+	env := envToMap(BuildEnv(nil, meta, map[string]string{"PIGEON_HOSTNAME": "custom"}, "/"))
+	if env["PIGEON_HOSTNAME"] != "custom" {
+		t.Errorf("PIGEON_HOSTNAME: got %q, want custom", env["PIGEON_HOSTNAME"])
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	m := ReadMetadata(&config.RunConfig{
+		Hostname:  "web-1",
+		VMID:      "vm-abc",
+		IPConfigs: []config.IPConfig{{IP: "10.0.0.2", Mask: 24}, {IP: "fdaa::2", Mask: 64}},
+	})
+	if m.Hostname != "web-1" || m.VMID != "vm-abc" || m.PrivateIP != "10.0.0.2" || !sliceEqual(m.PrivateIPs, []string{"10.0.0.2", "fdaa::2"}) {
+		t.Errorf("ReadMetadata: got %+v", m)
+	}
+	if m.MemoryMB <= 0 || m.CPUs <= 0 {
+		t.Errorf("ReadMetadata: memory %d MB, %d CPUs", m.MemoryMB, m.CPUs)
+	}
+}
+
+func TestMemTotalMB(t *testing.T) {
+	in := "MemTotal:        2048000 kB\nMemFree:         1024000 kB\n"
+	if got := memTotalMB(strings.NewReader(in)); got != 2000 {
+		t.Errorf("memTotalMB: got %d, want 2000", got)
+	}
+	if got := memTotalMB(strings.NewReader("garbage")); got != 0 {
+		t.Errorf("memTotalMB(garbage): got %d, want 0", got)
+	}
+}
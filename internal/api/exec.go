@@ -3,7 +3,9 @@
 // Route: GET /v1/ws/exec
 //
 //	Client → Server:
-//	  Text (first):  {"command":["cmd",...], "tty": bool}   Init
+//	  Text (first):  {"command":["cmd",...], "tty": bool,   Init
+//	                  "user": "user[:group]",               (optional)
+//	                  "join_workload": bool}                (optional)
 //	  Text:          {"cols": N, "rows": N}                 Resize (tty only)
 //	  Binary:        raw stdin bytes
 //	  Close:         terminate session
@@ -21,7 +23,6 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"syscall"
 	"time"
 
@@ -33,6 +34,8 @@ import (
 type initMsg struct {
 	Command []string `json:"command"`
 	TTY     bool     `json:"tty"`
+	User    string   `json:"user,omitempty"`
+	Join    bool     `json:"join_workload,omitempty"`
 }
 
 type resizeMsg struct {
@@ -69,11 +72,19 @@ func (s *Server) handleExecWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.logger.Debug("ws exec", "command", init.Command, "tty", init.TTY)
+	s.logger.Debug("ws exec", "command", init.Command, "tty", init.TTY, "user", init.User)
 
-	// Build command.
-	cmd := exec.Command(init.Command[0], init.Command[1:]...)
-	cmd.Env = s.env
+	spec, err := s.execSpecFor(init.User, init.Join)
+	if err != nil {
+		wsError(c, ctx, "exec spec: "+err.Error())
+		return
+	}
+
+	// Build command. TERM goes into the spec: Spec.Command owns cmd.Env.
+	if init.TTY {
+		spec.Env = append(append([]string{}, spec.Env...), "TERM=xterm-256color")
+	}
+	cmd := spec.Command(context.Background(), init.Command)
 
 	var (
 		stdinW  io.Writer // nil in non-tty mode
@@ -84,7 +95,6 @@ func (s *Server) handleExecWS(w http.ResponseWriter, r *http.Request) {
 	// Spawn (hold reap lock to prevent race).
 	s.supervisor.Lock()
 	if init.TTY {
-		cmd.Env = append(append([]string{}, s.env...), "TERM=xterm-256color")
 		ptmx, err = pty.Start(cmd)
 		if err != nil {
 			s.supervisor.Unlock()
@@ -103,7 +113,7 @@ func (s *Server) handleExecWS(w http.ResponseWriter, r *http.Request) {
 		}
 		cmd.Stdout = pw
 		cmd.Stderr = os.Stderr
-		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		cmd.SysProcAttr.Setpgid = true
 		if err := cmd.Start(); err != nil {
 			s.supervisor.Unlock()
 			pr.Close()
@@ -5,16 +5,34 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/pigeon-as/pigeon-init/internal/clock"
+	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/process"
+	"github.com/pigeon-as/pigeon-init/internal/render"
 )
 
+// Exec sessions re-execute /proc/self/exe, which is the test binary here.
+func TestMain(m *testing.M) {
+	if process.IsChild() {
+		process.ChildMain()
+	}
+	os.Exit(m.Run())
+}
+
 func newTestServer(t *testing.T) *Server {
 	t.Helper()
 	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
-	return NewServer(nil, []string{"PATH=/bin"}, logger)
+	return NewServer(nil, process.Spec{Env: []string{"PATH=/bin"}}, nil, nil, nil, logger)
 }
 
 func TestHandleStatus(t *testing.T) {
@@ -28,12 +46,15 @@ func TestHandleStatus(t *testing.T) {
 		t.Errorf("status code: got %d, want 200", rec.Code)
 	}
 
-	var body map[string]bool
+	var body struct {
+		OK           bool `json:"ok"`
+		RestartCount int  `json:"restart_count"`
+	}
 	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
 		t.Fatalf("decode: %v", err)
 	}
-	if !body["ok"] {
-		t.Errorf("status: got %v, want ok=true", body)
+	if !body.OK || body.RestartCount != 0 {
+		t.Errorf("status: got %+v, want ok=true and no restarts", body)
 	}
 }
 
@@ -100,6 +121,122 @@ func TestHandleExec_EmptyCmd(t *testing.T) {
 	}
 }
 
+func TestHandleExec_UnknownUser(t *testing.T) {
+	srv := newTestServer(t)
+
+	body, _ := json.Marshal(map[string]any{"cmd": []string{"id"}, "user": "pigeon-nonexistent-user"})
+	req := httptest.NewRequest("POST", "/v1/exec", bytes.NewBuffer(body))
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status code: got %d, want 400", rec.Code)
+	}
+}
+
+func TestHandleExec_DoesNotBlockSignals(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	got := filepath.Join(t.TempDir(), "got")
+	sup, err := process.New([]string{"sh", "-c", "trap 'echo usr1 > " + got + "' USR1; while :; do sleep 0.05; done"}, process.Spec{}, logger)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := sup.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	done := make(chan process.Result)
+	go func() { done <- sup.Run() }()
+	defer func() {
+		sup.SignalCh <- syscall.SIGKILL
+		<-done
+	}()
+	srv := NewServer(sup, process.Spec{Env: []string{"PATH=/usr/bin:/bin"}}, nil, nil, nil, logger)
+
+	rec := httptest.NewRecorder()
+	execDone := make(chan struct{})
+	go func() {
+		defer close(execDone)
+		body, _ := json.Marshal(map[string]any{"cmd": []string{"sh", "-c", "echo out; echo err >&2; sleep 1; exit 4"}})
+		srv.mux.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/exec", bytes.NewBuffer(body)))
+	}()
+
+	// A signal to the workload goes through while the exec is running.
+	time.Sleep(200 * time.Millisecond)
+	sup.SignalCh <- syscall.SIGUSR1
+	deadline := time.Now().Add(700 * time.Millisecond)
+	for {
+		if _, err := os.Stat(got); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("signal held up by a running exec")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case <-execDone:
+		t.Fatal("exec finished before the signal was checked")
+	default:
+	}
+
+	<-execDone
+	var res struct {
+		ExitCode int    `json:"exit_code"`
+		Stdout   string `json:"stdout"`
+		Stderr   string `json:"stderr"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body, err)
+	}
+	if res.ExitCode != 4 || res.Stdout != "out\n" || res.Stderr != "err\n" {
+		t.Errorf("exec result: got %+v", res)
+	}
+}
+
+func TestHandleClock_Disabled(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/v1/clock", nil)
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status code: got %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleHealth_Disabled(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/v1/health", nil)
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status code: got %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleClock(t *testing.T) {
+	srv := newTestServer(t)
+	srv.clock = clock.NewSyncer("/dev/ptp0", 0, srv.logger)
+
+	req := httptest.NewRequest("GET", "/v1/clock", nil)
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code: got %d, want 200", rec.Code)
+	}
+	var body clock.Status
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Device != "/dev/ptp0" {
+		t.Errorf("device: got %q, want /dev/ptp0", body.Device)
+	}
+}
+
 func TestRouteRegistration(t *testing.T) {
 	srv := newTestServer(t)
 
@@ -146,3 +283,33 @@ func TestWriteJSON(t *testing.T) {
 		t.Errorf("body: got %v", body)
 	}
 }
+
+func TestHandleConfig_RendersTemplates(t *testing.T) {
+	srv := newTestServer(t)
+	srv.render = render.New([]string{"PORT=8080"}, uint32(os.Getuid()), uint32(os.Getgid()), srv.logger)
+	path := filepath.Join(t.TempDir(), "app.conf")
+
+	body, _ := json.Marshal(config.RunConfig{
+		Templates: []config.Template{{Path: path, Template: "port={{.Env.PORT}}"}},
+	})
+	req := httptest.NewRequest("PUT", "/v1/config", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code: got %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "port=8080" {
+		t.Errorf("rendered: got %q, want port=8080", got)
+	}
+
+	body, _ = json.Marshal(config.RunConfig{
+		Templates: []config.Template{{Path: path, Template: "{{.Nope}}"}},
+	})
+	req = httptest.NewRequest("PUT", "/v1/config", bytes.NewReader(body))
+	rec = httptest.NewRecorder()
+	srv.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("bad template: got %d, want 422", rec.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// DefaultMetadataPrefix prefixes the metadata variable names.
+const DefaultMetadataPrefix = "PIGEON_"
+
+// Metadata describes the VM to the workload.
+type Metadata struct {
+	Hostname   string
+	PrivateIP  string   // first IPConfigs address
+	PrivateIPs []string // all IPConfigs addresses
+	VMID       string
+	MemoryMB   int // at boot, before any hotplug
+	CPUs       int
+}
+
+// ReadMetadata collects metadata from cfg and /proc.
+func ReadMetadata(cfg *config.RunConfig) Metadata {
+	m := Metadata{
+		Hostname: cfg.Hostname,
+		VMID:     cfg.VMID,
+		CPUs:     runtime.NumCPU(),
+	}
+	for _, ip := range cfg.IPConfigs {
+		m.PrivateIPs = append(m.PrivateIPs, ip.IP)
+	}
+	if len(m.PrivateIPs) > 0 {
+		m.PrivateIP = m.PrivateIPs[0]
+	}
+	if f, err := os.Open("/proc/meminfo"); err == nil {
+		m.MemoryMB = memTotalMB(f)
+		f.Close()
+	}
+	return m
+}
+
+// memTotalMB returns MemTotal from meminfo content, or 0.
+func memTotalMB(r io.Reader) int {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0
+			}
+			return kb / 1024
+		}
+	}
+	return 0
+}
+
+// Env returns the metadata as variables named with prefix, omitting
+// unknown values. It is meant as init-derived env for BuildEnv.
+func (m Metadata) Env(prefix string) map[string]string {
+	env := make(map[string]string)
+	set := func(name, value string) {
+		if value != "" && value != "0" {
+			env[prefix+name] = value
+		}
+	}
+	set("HOSTNAME", m.Hostname)
+	set("PRIVATE_IP", m.PrivateIP)
+	set("PRIVATE_IPS", strings.Join(m.PrivateIPs, ","))
+	set("VM_ID", m.VMID)
+	set("MEMORY_MB", strconv.Itoa(m.MemoryMB))
+	set("CPUS", strconv.Itoa(m.CPUs))
+	return env
+}
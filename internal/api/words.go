@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CmdOverride modes.
+const (
+	CmdLiteral = "literal" // one argument, as is (default)
+	CmdWords   = "words"   // split into POSIX shell words
+	CmdShell   = "shell"   // run by Shell, like a Dockerfile shell-form CMD
+)
+
+var defaultShell = []string{"/bin/sh", "-c"}
+
+// ParseCmdOverride turns a CmdOverride string into the cmd portion of argv
+// according to mode. shell defaults to /bin/sh -c.
+func ParseCmdOverride(s string, mode string, shell []string) ([]string, error) {
+	switch mode {
+	case "", CmdLiteral:
+		return []string{s}, nil
+	case CmdWords:
+		words, err := SplitWords(s)
+		if err != nil {
+			return nil, fmt.Errorf("CmdOverride: %w", err)
+		}
+		return words, nil
+	case CmdShell:
+		if len(shell) == 0 {
+			shell = defaultShell
+		}
+		return append(append([]string(nil), shell...), s), nil
+	default:
+		return nil, fmt.Errorf("unknown CmdOverride mode %q", mode)
+	}
+}
+
+// SplitWords splits s into words the way a POSIX shell does before
+// expansion: unquoted blanks separate words, backslash escapes the next
+// character, single quotes preserve everything, and inside double quotes
+// backslash only escapes $ ` " \ and newline. No expansion is performed and
+// operators such as | and ; are ordinary characters. A blank s yields an
+// empty, non-nil slice, which as a cmd override means no arguments.
+func SplitWords(s string) ([]string, error) {
+	var (
+		words   = []string{}
+		word    strings.Builder
+		inWord  bool
+		quote   byte // '\'', '"' or 0
+		quoteAt int
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch quote {
+		case '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+			continue
+		case '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0:
+				i++
+				if s[i] != '\n' {
+					word.WriteByte(s[i])
+				}
+			default:
+				word.WriteByte(c)
+			}
+			continue
+		}
+
+		switch c {
+		case ' ', '\t', '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("trailing backslash in %q", s)
+			}
+			i++
+			if s[i] == '\n' { // line continuation
+				continue
+			}
+			word.WriteByte(s[i])
+			inWord = true
+		case '\'', '"':
+			quote, quoteAt = c, i
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		kind := "single"
+		if quote == '"' {
+			kind = "double"
+		}
+		return nil, fmt.Errorf("unterminated %s quote at offset %d in %q", kind, quoteAt, s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -106,7 +106,18 @@ func MountEssential() error {
 	return nil
 }
 
-func MountCgroups(logger *slog.Logger) error {
+// v1 hierarchies left unmounted when their controllers are delegated to cgroup2.
+var delegatedControllers = map[string]bool{
+	"memory":      true,
+	"cpu,cpuacct": true,
+	"pids":        true,
+	"blkio":       true,
+}
+
+// MountCgroups mounts the v1 + v2 hybrid layout. With delegate set, the
+// memory, cpu, pids and io controllers are left to cgroup2 so resource
+// limits can be applied there.
+func MountCgroups(delegate bool, logger *slog.Logger) error {
 	base := "/sys/fs/cgroup"
 	flags := uintptr(unix.MS_NODEV | unix.MS_NOEXEC | unix.MS_NOSUID | unix.MS_RELATIME)
 
@@ -138,6 +149,9 @@ func MountCgroups(logger *slog.Logger) error {
 		"cpuset",
 	}
 	for _, ctrl := range controllers {
+		if delegate && delegatedControllers[ctrl] {
+			continue
+		}
 		dir := filepath.Join(base, ctrl)
 		if err := os.MkdirAll(dir, 0555); err != nil {
 			return err
@@ -0,0 +1,141 @@
+package boot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// Container runtime defaults (runc).
+var (
+	DefaultMaskedPaths = []string{
+		"/proc/acpi",
+		"/proc/asound",
+		"/proc/interrupts",
+		"/proc/kcore",
+		"/proc/keys",
+		"/proc/latency_stats",
+		"/proc/sched_debug",
+		"/proc/scsi",
+		"/proc/timer_list",
+		"/proc/timer_stats",
+		"/sys/devices/virtual/powercap",
+		"/sys/firmware",
+	}
+	DefaultReadOnlyPaths = []string{
+		"/proc/bus",
+		"/proc/fs",
+		"/proc/irq",
+		"/proc/sys",
+		"/proc/sysrq-trigger",
+	}
+)
+
+// HardenRootfs mounts the writable paths, masks and read-only paths from fs,
+// then remounts / read-only if requested. Missing writable path targets are
+// created owned by uid:gid.
+func HardenRootfs(fs *config.Filesystem, uid, gid uint32) error {
+	if fs == nil {
+		return nil
+	}
+
+	for _, w := range fs.WritablePaths {
+		if err := mountWritable(w, uid, gid); err != nil {
+			return fmt.Errorf("writable path %s: %w", w.Path, err)
+		}
+	}
+
+	masked := fs.MaskedPaths
+	if masked == nil {
+		masked = DefaultMaskedPaths
+	}
+	for _, p := range masked {
+		if err := maskPath(p); err != nil {
+			return fmt.Errorf("mask %s: %w", p, err)
+		}
+	}
+
+	readOnly := fs.ReadOnlyPaths
+	if readOnly == nil {
+		readOnly = DefaultReadOnlyPaths
+	}
+	for _, p := range readOnly {
+		if err := readOnlyPath(p); err != nil {
+			return fmt.Errorf("read-only %s: %w", p, err)
+		}
+	}
+
+	if fs.ReadOnlyRoot {
+		// Only this mount becomes read-only; the superblock and submounts
+		// (/dev, /proc, /run, volumes, writable paths) are unaffected.
+		if err := unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, ""); err != nil {
+			return fmt.Errorf("remount / read-only: %w", err)
+		}
+	}
+	return nil
+}
+
+// mountWritable bind-mounts w.Source onto w.Path, or mounts a tmpfs with the
+// mode and owner of the existing directory.
+func mountWritable(w config.WritablePath, uid, gid uint32) error {
+	if !filepath.IsAbs(w.Path) {
+		return fmt.Errorf("path must be absolute")
+	}
+	st, err := os.Stat(w.Path)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(w.Path, 0755); err != nil {
+			return err
+		}
+		if err := os.Chown(w.Path, int(uid), int(gid)); err != nil {
+			return err
+		}
+		st, err = os.Stat(w.Path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.Source != "" {
+		return unix.Mount(w.Source, w.Path, "", unix.MS_BIND|unix.MS_REC, "")
+	}
+	sys := st.Sys().(*syscall.Stat_t)
+	data := fmt.Sprintf("mode=%o,uid=%d,gid=%d", sys.Mode&07777, sys.Uid, sys.Gid)
+	if w.Size > 0 {
+		data += fmt.Sprintf(",size=%d", w.Size)
+	}
+	return unix.Mount("tmpfs", w.Path, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, data)
+}
+
+// maskPath hides a file behind /dev/null or a directory behind an empty
+// read-only tmpfs. Missing paths are skipped.
+func maskPath(path string) error {
+	st, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if st.IsDir() {
+		return unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY, "size=0")
+	}
+	return unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+}
+
+// readOnlyPath bind-mounts path onto itself read-only. Missing paths are
+// skipped.
+func readOnlyPath(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC)
+	return unix.Mount("", path, "", flags, "")
+}
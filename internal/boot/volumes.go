@@ -0,0 +1,144 @@
+package boot
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// MountVolumes mounts a tmpfs on each image volume that isn't listed in
+// skip or already a mount point, seeded with the image content at that
+// path as Docker does for new volumes. Missing paths are created owned by
+// uid:gid. Returns the mounted paths, parents first.
+func MountVolumes(volumes map[string]struct{}, skip []string, uid, gid uint32) ([]string, error) {
+	paths := make([]string, 0, len(volumes))
+	for p := range volumes {
+		paths = append(paths, filepath.Clean(p))
+	}
+	sort.Strings(paths)
+
+	skipped := make(map[string]bool, len(skip))
+	for _, p := range skip {
+		skipped[filepath.Clean(p)] = true
+	}
+
+	var mounted []string
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			return mounted, fmt.Errorf("volume %s: path must be absolute", p)
+		}
+		if skipped[p] || isMountPoint(p) {
+			continue
+		}
+		if err := mountVolume(p, uid, gid); err != nil {
+			return mounted, fmt.Errorf("volume %s: %w", p, err)
+		}
+		mounted = append(mounted, p)
+	}
+	return mounted, nil
+}
+
+// isMountPoint reports whether path is on a different device than its
+// parent, which catches the block device and tmpfs mounts init makes.
+func isMountPoint(path string) bool {
+	var st, parent unix.Stat_t
+	if unix.Lstat(path, &st) != nil || unix.Lstat(filepath.Dir(path), &parent) != nil {
+		return false
+	}
+	return st.Dev != parent.Dev
+}
+
+func mountVolume(path string, uid, gid uint32) error {
+	// Keep the image directory open: once the tmpfs covers it, its content
+	// is still reachable through /proc/self/fd. The trailing "/." makes the
+	// walk follow that link.
+	dir, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return mountWritable(config.WritablePath{Path: path}, uid, gid)
+	}
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	if err := mountWritable(config.WritablePath{Path: path}, uid, gid); err != nil {
+		return err
+	}
+	if err := copyTree(fmt.Sprintf("/proc/self/fd/%d/.", dir.Fd()), path); err != nil {
+		_ = unix.Unmount(path, unix.MNT_DETACH)
+		return fmt.Errorf("copy image content: %w", err)
+	}
+	return nil
+}
+
+// copyTree copies directories, regular files and symlinks under src into
+// dst, keeping modes and owners. Other file types are skipped.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		st := info.Sys().(*syscall.Stat_t)
+
+		switch {
+		case d.IsDir():
+			if err := os.Mkdir(target, 0700); err != nil {
+				return err
+			}
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			return os.Lchown(target, int(st.Uid), int(st.Gid))
+		case d.Type().IsRegular():
+			if err := copyFile(p, target); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		// chown clears setuid and setgid, so the mode goes last.
+		if err := os.Chown(target, int(st.Uid), int(st.Gid)); err != nil {
+			return err
+		}
+		return unix.Chmod(target, st.Mode&07777)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
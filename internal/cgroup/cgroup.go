@@ -0,0 +1,100 @@
+package cgroup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// Root is the cgroup2 hierarchy mounted by boot.MountCgroups.
+const Root = "/sys/fs/cgroup/unified"
+
+const defaultCPUPeriod = 100000
+
+// Controllers are delegated to the unified hierarchy when resource limits
+// are configured.
+var Controllers = []string{"memory", "cpu", "pids", "io"}
+
+type Group struct {
+	path string
+	dir  *os.File
+}
+
+// EnableControllers enables Controllers for children of the root cgroup.
+// Controllers still bound to a v1 hierarchy are skipped with a warning.
+func EnableControllers(logger *slog.Logger) {
+	path := filepath.Join(Root, "cgroup.subtree_control")
+	for _, c := range Controllers {
+		if err := os.WriteFile(path, []byte("+"+c), 0644); err != nil {
+			logger.Warn("enable cgroup controller failed", "controller", c, "err", err)
+		}
+	}
+}
+
+// New creates (or reuses) a child of the root cgroup.
+func New(name string) (*Group, error) {
+	path := filepath.Join(Root, name)
+	if err := os.Mkdir(path, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("mkdir %s: %w", path, err)
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return &Group{path: path, dir: dir}, nil
+}
+
+func (g *Group) Path() string {
+	return g.path
+}
+
+// FD returns a descriptor for SysProcAttr.CgroupFD.
+func (g *Group) FD() int {
+	return int(g.dir.Fd())
+}
+
+// Set writes the configured limits. All limits are attempted; failures are
+// joined into the returned error.
+func (g *Group) Set(res *config.Resources) error {
+	if res == nil {
+		return nil
+	}
+	var errs []error
+	if res.MemoryMax > 0 {
+		errs = append(errs, g.write("memory.max", strconv.FormatInt(res.MemoryMax, 10)))
+	}
+	if res.MemoryHigh > 0 {
+		errs = append(errs, g.write("memory.high", strconv.FormatInt(res.MemoryHigh, 10)))
+	}
+	if res.CPUQuota > 0 {
+		period := res.CPUPeriod
+		if period <= 0 {
+			period = defaultCPUPeriod
+		}
+		errs = append(errs, g.write("cpu.max", fmt.Sprintf("%d %d", res.CPUQuota, period)))
+	}
+	if res.PidsMax > 0 {
+		errs = append(errs, g.write("pids.max", strconv.FormatInt(res.PidsMax, 10)))
+	}
+	if res.IOWeight > 0 {
+		errs = append(errs, g.write("io.weight", fmt.Sprintf("default %d", res.IOWeight)))
+	}
+	return errors.Join(errs...)
+}
+
+// Kill SIGKILLs every process in the group via cgroup.kill (Linux 5.14+).
+func (g *Group) Kill() error {
+	return g.write("cgroup.kill", "1")
+}
+
+func (g *Group) write(file, value string) error {
+	if err := os.WriteFile(filepath.Join(g.path, file), []byte(value), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", file, err)
+	}
+	return nil
+}
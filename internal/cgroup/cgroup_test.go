@@ -0,0 +1,72 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+func TestSet_WritesLimits(t *testing.T) {
+	g := &Group{path: t.TempDir()}
+
+	err := g.Set(&config.Resources{
+		MemoryMax:  256 << 20,
+		MemoryHigh: 200 << 20,
+		CPUQuota:   50000,
+		PidsMax:    512,
+		IOWeight:   200,
+	})
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	want := map[string]string{
+		"memory.max":  "268435456",
+		"memory.high": "209715200",
+		"cpu.max":     "50000 100000",
+		"pids.max":    "512",
+		"io.weight":   "default 200",
+	}
+	for file, v := range want {
+		got, err := os.ReadFile(filepath.Join(g.path, file))
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if string(got) != v {
+			t.Errorf("%s: got %q, want %q", file, got, v)
+		}
+	}
+}
+
+func TestSet_ZeroValuesSkipped(t *testing.T) {
+	g := &Group{path: t.TempDir()}
+
+	if err := g.Set(&config.Resources{CPUQuota: 20000, CPUPeriod: 50000}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	entries, _ := os.ReadDir(g.path)
+	if len(entries) != 1 {
+		t.Errorf("expected only cpu.max, got %d files", len(entries))
+	}
+	got, _ := os.ReadFile(filepath.Join(g.path, "cpu.max"))
+	if string(got) != "20000 50000" {
+		t.Errorf("cpu.max: got %q", got)
+	}
+}
+
+func TestSet_NilIsNoop(t *testing.T) {
+	g := &Group{path: "/nonexistent"}
+	if err := g.Set(nil); err != nil {
+		t.Errorf("Set(nil): %v", err)
+	}
+}
+
+func TestSet_JoinsErrors(t *testing.T) {
+	g := &Group{path: filepath.Join(t.TempDir(), "missing")}
+	if err := g.Set(&config.Resources{MemoryMax: 1, PidsMax: 1}); err == nil {
+		t.Error("Set on missing cgroup: expected error")
+	}
+}
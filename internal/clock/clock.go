@@ -0,0 +1,177 @@
+package clock
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// adjtimex modes (include/uapi/linux/timex.h).
+const (
+	adjSetOffset        = 0x0100
+	adjNano             = 0x2000
+	adjOffsetSingleshot = 0x8001
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	// Offsets above stepThreshold are stepped; smaller ones are slewed.
+	stepThreshold = 100 * time.Millisecond
+)
+
+// Clock adjustments, replaced in tests.
+var (
+	stepClock = step
+	slewClock = slew
+)
+
+// Set steps CLOCK_REALTIME to t.
+func Set(t time.Time) error {
+	ts := unix.NsecToTimespec(t.UnixNano())
+	if err := unix.ClockSettime(unix.CLOCK_REALTIME, &ts); err != nil {
+		return fmt.Errorf("clock_settime: %w", err)
+	}
+	return nil
+}
+
+type Status struct {
+	Device   string    `json:"device"`
+	OffsetNs int64     `json:"offset_ns"` // PTP time minus system time at LastSync
+	Stepped  int       `json:"stepped"`
+	LastSync time.Time `json:"last_sync"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Syncer disciplines CLOCK_REALTIME against a PTP clock (kvm-ptp exposes
+// the host clock as /dev/ptp0).
+type Syncer struct {
+	device   string
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu     sync.Mutex
+	status Status
+}
+
+func NewSyncer(device string, interval time.Duration, logger *slog.Logger) *Syncer {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Syncer{
+		device:   device,
+		interval: interval,
+		logger:   logger,
+		status:   Status{Device: device},
+	}
+}
+
+func (s *Syncer) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Run syncs immediately and then every interval until ctx is done.
+func (s *Syncer) Run(ctx context.Context) error {
+	f, err := os.Open(s.device)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", s.device, err)
+	}
+	defer f.Close()
+	clockID := int32((^int(f.Fd()))<<3 | 3) // FD_TO_CLOCKID
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.sync(clockID)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Syncer) sync(clockID int32) {
+	offset, err := measure(clockID)
+	if err == nil {
+		err = s.correct(offset)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.status.Error = err.Error()
+		s.logger.Warn("clock sync failed", "device", s.device, "err", err)
+		return
+	}
+	s.status.OffsetNs = int64(offset)
+	s.status.LastSync = time.Now()
+	s.status.Error = ""
+	s.logger.Debug("clock synced", "offset", offset)
+}
+
+func (s *Syncer) correct(offset time.Duration) error {
+	if offset > stepThreshold || offset < -stepThreshold {
+		if err := stepClock(offset); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.status.Stepped++
+		s.mu.Unlock()
+		s.logger.Info("clock stepped", "offset", offset)
+		return nil
+	}
+	return slewClock(offset)
+}
+
+// measure returns PTP time minus CLOCK_REALTIME, sampling the system clock
+// on both sides of the PTP read.
+func measure(clockID int32) (time.Duration, error) {
+	var before, ptp, after unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_REALTIME, &before); err != nil {
+		return 0, err
+	}
+	if err := unix.ClockGettime(clockID, &ptp); err != nil {
+		return 0, fmt.Errorf("read PTP clock: %w", err)
+	}
+	if err := unix.ClockGettime(unix.CLOCK_REALTIME, &after); err != nil {
+		return 0, err
+	}
+	mid := (before.Nano() + after.Nano()) / 2
+	return time.Duration(ptp.Nano() - mid), nil
+}
+
+func step(offset time.Duration) error {
+	sec, nsec := splitOffset(offset)
+	tx := unix.Timex{Modes: adjSetOffset | adjNano}
+	tx.Time.Sec, tx.Time.Usec = sec, nsec
+	if _, err := unix.Adjtimex(&tx); err != nil {
+		return fmt.Errorf("adjtimex step: %w", err)
+	}
+	return nil
+}
+
+// splitOffset splits offset for ADJ_SETOFFSET, which wants a non-negative
+// nanosecond part.
+func splitOffset(offset time.Duration) (int64, int64) {
+	sec, nsec := int64(offset/time.Second), int64(offset%time.Second)
+	if nsec < 0 {
+		sec--
+		nsec += int64(time.Second)
+	}
+	return sec, nsec
+}
+
+func slew(offset time.Duration) error {
+	tx := unix.Timex{Modes: adjOffsetSingleshot, Offset: offset.Microseconds()}
+	if _, err := unix.Adjtimex(&tx); err != nil {
+		return fmt.Errorf("adjtimex slew: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package clock
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSyncer_StepsOrSlews(t *testing.T) {
+	var stepped, slewed []time.Duration
+	origStep, origSlew := stepClock, slewClock
+	stepClock = func(d time.Duration) error { stepped = append(stepped, d); return nil }
+	slewClock = func(d time.Duration) error { slewed = append(slewed, d); return nil }
+	t.Cleanup(func() { stepClock, slewClock = origStep, origSlew })
+
+	s := NewSyncer("/dev/ptp0", 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for _, offset := range []time.Duration{
+		2 * time.Second,
+		-time.Second,
+		stepThreshold,
+		-50 * time.Millisecond,
+		0,
+	} {
+		if err := s.correct(offset); err != nil {
+			t.Fatalf("correct(%v): %v", offset, err)
+		}
+	}
+
+	if len(stepped) != 2 || stepped[0] != 2*time.Second || stepped[1] != -time.Second {
+		t.Errorf("stepped %v, want [2s -1s]", stepped)
+	}
+	if len(slewed) != 3 {
+		t.Errorf("slewed %v, want the 3 offsets within the threshold", slewed)
+	}
+	if got := s.Status().Stepped; got != 2 {
+		t.Errorf("Stepped: got %d, want 2", got)
+	}
+}
+
+func TestSplitOffset(t *testing.T) {
+	for offset, want := range map[time.Duration][2]int64{
+		1500 * time.Millisecond:  {1, 500_000_000},
+		-1500 * time.Millisecond: {-2, 500_000_000},
+		-time.Second:             {-1, 0},
+		-time.Nanosecond:         {-1, 999_999_999},
+	} {
+		sec, nsec := splitOffset(offset)
+		if sec != want[0] || nsec != want[1] {
+			t.Errorf("splitOffset(%v) = %d, %d; want %d, %d", offset, sec, nsec, want[0], want[1])
+		}
+	}
+}
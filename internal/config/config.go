@@ -4,29 +4,79 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 )
 
 type RunConfig struct {
-	ImageConfig  *ImageConfig      `json:"ImageConfig,omitempty"`
-	ExecOverride []string          `json:"ExecOverride,omitempty"`
-	CmdOverride  *string           `json:"CmdOverride,omitempty"`
-	UserOverride *string           `json:"UserOverride,omitempty"`
-	ExtraEnv     map[string]string `json:"ExtraEnv,omitempty"`
-	IPConfigs    []IPConfig        `json:"IPConfigs,omitempty"`
-	MTU          int               `json:"MTU,omitempty"`
-	Hostname     string            `json:"Hostname,omitempty"`
-	Mounts       []Mount           `json:"Mounts,omitempty"`
-	RootDevice   *string           `json:"RootDevice,omitempty"`
-	EtcResolv    *EtcResolv        `json:"EtcResolv,omitempty"`
-	EtcHosts     []EtcHost         `json:"EtcHosts,omitempty"`
+	ImageConfig       *ImageConfig      `json:"ImageConfig,omitempty"`
+	ExecOverride      []string          `json:"ExecOverride,omitempty"`
+	CmdOverride       *string           `json:"CmdOverride,omitempty"`
+	CmdOverrideMode   string            `json:"CmdOverrideMode,omitempty"` // literal, words or shell
+	Shell             []string          `json:"Shell,omitempty"`           // default ["/bin/sh", "-c"]
+	UserOverride      *string           `json:"UserOverride,omitempty"`
+	ExtraGroups       []string          `json:"ExtraGroups,omitempty"`
+	ExtraEnv          map[string]string `json:"ExtraEnv,omitempty"`
+	IPConfigs         []IPConfig        `json:"IPConfigs,omitempty"`
+	MTU               int               `json:"MTU,omitempty"`
+	Hostname          string            `json:"Hostname,omitempty"`
+	Mounts            []Mount           `json:"Mounts,omitempty"`
+	RootDevice        *string           `json:"RootDevice,omitempty"`
+	EtcResolv         *EtcResolv        `json:"EtcResolv,omitempty"`
+	EtcHosts          []EtcHost         `json:"EtcHosts,omitempty"`
+	Resources         *Resources        `json:"Resources,omitempty"`
+	ExecResources     *Resources        `json:"ExecResources,omitempty"`
+	Rlimits           map[string]Rlimit `json:"Rlimits,omitempty"`
+	ExecRlimits       bool              `json:"ExecRlimits,omitempty"`
+	Sysctls           map[string]string `json:"Sysctls,omitempty"`
+	SysctlPolicy      *SysctlPolicy     `json:"SysctlPolicy,omitempty"`
+	KernelModules     []string          `json:"KernelModules,omitempty"`
+	EntropySeed       []byte            `json:"EntropySeed,omitempty"` // base64 in JSON
+	Clock             *Clock            `json:"Clock,omitempty"`
+	Timezone          string            `json:"Timezone,omitempty"`
+	MemoryHotplug     *MemoryHotplug    `json:"MemoryHotplug,omitempty"`
+	Swap              *Swap             `json:"Swap,omitempty"`
+	Security          *Security         `json:"Security,omitempty"`
+	ExecSecurity      bool              `json:"ExecSecurity,omitempty"`
+	Filesystem        *Filesystem       `json:"Filesystem,omitempty"`
+	Namespaces        *Namespaces       `json:"Namespaces,omitempty"`
+	Scheduling        *Scheduling       `json:"Scheduling,omitempty"`
+	ExecScheduling    *Scheduling       `json:"ExecScheduling,omitempty"`
+	InitOOMScoreAdj   *int              `json:"InitOOMScoreAdj,omitempty"` // default -1000
+	Umask             string            `json:"Umask,omitempty"`           // octal, e.g. "0027"
+	CreateWorkingDir  bool              `json:"CreateWorkingDir,omitempty"`
+	CreateUser        bool              `json:"CreateUser,omitempty"`
+	VMID              string            `json:"VMID,omitempty"`
+	CACertificates    []string          `json:"CACertificates,omitempty"` // PEM
+	MetadataEnv       bool              `json:"MetadataEnv,omitempty"`
+	MetadataEnvPrefix *string           `json:"MetadataEnvPrefix,omitempty"` // default "PIGEON_"
+	Templates         []Template        `json:"Templates,omitempty"`
+	Processes         []Process         `json:"Processes,omitempty"`
+	Restart           *RestartPolicy    `json:"Restart,omitempty"` // workload; default never
 }
 
 type ImageConfig struct {
-	Entrypoint []string `json:"Entrypoint,omitempty"`
-	Cmd        []string `json:"Cmd,omitempty"`
-	Env        []string `json:"Env,omitempty"`
-	WorkingDir string   `json:"WorkingDir,omitempty"`
-	User       string   `json:"User,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	User         string              `json:"User,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	Healthcheck  *Healthcheck        `json:"Healthcheck,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	ArgsEscaped  bool                `json:"ArgsEscaped,omitempty"` // Windows only
+}
+
+// Healthcheck follows the Docker image config format; durations are
+// nanoseconds in JSON.
+type Healthcheck struct {
+	Test          []string      `json:"Test,omitempty"`
+	Interval      time.Duration `json:"Interval,omitempty"`
+	Timeout       time.Duration `json:"Timeout,omitempty"`
+	StartPeriod   time.Duration `json:"StartPeriod,omitempty"`
+	StartInterval time.Duration `json:"StartInterval,omitempty"`
+	Retries       int           `json:"Retries,omitempty"`
 }
 
 type IPConfig struct {
@@ -50,6 +100,143 @@ type EtcHost struct {
 	Desc string `json:"Desc,omitempty"`
 }
 
+// Resources are cgroup2 limits. Zero values leave the kernel default.
+type Resources struct {
+	MemoryMax  int64 `json:"MemoryMax,omitempty"`  // bytes
+	MemoryHigh int64 `json:"MemoryHigh,omitempty"` // bytes
+	CPUQuota   int64 `json:"CPUQuota,omitempty"`   // µs per CPUPeriod
+	CPUPeriod  int64 `json:"CPUPeriod,omitempty"`  // µs, default 100000
+	PidsMax    int64 `json:"PidsMax,omitempty"`
+	IOWeight   int   `json:"IOWeight,omitempty"` // 1-10000
+}
+
+// Rlimit is a soft/hard resource limit pair. Negative values mean unlimited.
+type Rlimit struct {
+	Soft int64 `json:"Soft"`
+	Hard int64 `json:"Hard"`
+}
+
+// SysctlPolicy overrides which Sysctls may be set. Entries are dotted keys
+// covering their subtrees. A nil list keeps the default.
+type SysctlPolicy struct {
+	Allow []string `json:"Allow,omitempty"`
+	Deny  []string `json:"Deny,omitempty"`
+}
+
+type Clock struct {
+	Time         *time.Time `json:"Time,omitempty"`         // host wall clock, RFC 3339
+	PTPDevice    string     `json:"PTPDevice,omitempty"`    // e.g. /dev/ptp0; enables the sync loop
+	SyncInterval int        `json:"SyncInterval,omitempty"` // seconds, default 10
+}
+
+type MemoryHotplug struct {
+	Policy string `json:"Policy,omitempty"` // online_movable (default) or online
+}
+
+type Swap struct {
+	Zram    *Zram        `json:"Zram,omitempty"`
+	Devices []SwapDevice `json:"Devices,omitempty"`
+}
+
+type Zram struct {
+	Size      int64  `json:"Size"`                // bytes
+	Algorithm string `json:"Algorithm,omitempty"` // e.g. lz4, zstd; kernel default if empty
+	Priority  int    `json:"Priority,omitempty"`  // default 100
+}
+
+// SwapDevice is a swap file or partition, typically on a volume from Mounts.
+type SwapDevice struct {
+	Path     string `json:"Path"`
+	Size     int64  `json:"Size,omitempty"` // bytes; creates the file if missing
+	Priority int    `json:"Priority,omitempty"`
+	Format   bool   `json:"Format,omitempty"` // mkswap an existing target without a swap signature
+}
+
+// Security restricts the workload's privileges. A nil Capabilities list
+// keeps the full bounding set; an empty one drops everything.
+type Security struct {
+	Capabilities        []string `json:"Capabilities"`
+	AmbientCapabilities []string `json:"AmbientCapabilities,omitempty"`
+	NoNewPrivileges     bool     `json:"NoNewPrivileges,omitempty"`
+	Seccomp             *Seccomp `json:"Seccomp,omitempty"`
+}
+
+// Seccomp selects an OCI/Docker JSON profile. With neither field set the
+// built-in default is used.
+type Seccomp struct {
+	Profile     json.RawMessage `json:"Profile,omitempty"`     // inline profile
+	ProfilePath string          `json:"ProfilePath,omitempty"` // file in the rootfs
+}
+
+// Filesystem hardens the workload's view of the rootfs. Nil MaskedPaths and
+// ReadOnlyPaths use the container runtime defaults; empty lists disable them.
+type Filesystem struct {
+	ReadOnlyRoot  bool           `json:"ReadOnlyRoot,omitempty"`
+	WritablePaths []WritablePath `json:"WritablePaths,omitempty"`
+	MaskedPaths   []string       `json:"MaskedPaths"`
+	ReadOnlyPaths []string       `json:"ReadOnlyPaths"`
+}
+
+// WritablePath stays writable under a read-only root: a tmpfs, or a bind
+// mount of Source (typically a directory on a volume from Mounts).
+type WritablePath struct {
+	Path   string `json:"Path"`
+	Source string `json:"Source,omitempty"`
+	Size   int64  `json:"Size,omitempty"` // tmpfs size in bytes
+}
+
+// Namespaces to create for the workload. PID and IPC imply Mount.
+type Namespaces struct {
+	Mount bool `json:"Mount,omitempty"`
+	PID   bool `json:"PID,omitempty"`
+	IPC   bool `json:"IPC,omitempty"`
+	UTS   bool `json:"UTS,omitempty"`
+}
+
+// Scheduling attributes for a spawned process. Nil fields keep the
+// defaults; oom_score_adj defaults to 0 rather than init's.
+type Scheduling struct {
+	OOMScoreAdj *int        `json:"OOMScoreAdj,omitempty"` // -1000..1000
+	Nice        *int        `json:"Nice,omitempty"`        // -20..19
+	CPUAffinity []int       `json:"CPUAffinity,omitempty"`
+	IOPriority  *IOPriority `json:"IOPriority,omitempty"`
+}
+
+type IOPriority struct {
+	Class string `json:"Class"` // realtime, best-effort or idle
+	Level int    `json:"Level"` // 0 (highest) to 7
+}
+
+// Template is a file rendered with text/template from Template or, if
+// empty, the rootfs file at Source.
+type Template struct {
+	Path     string `json:"Path"`
+	Template string `json:"Template,omitempty"`
+	Source   string `json:"Source,omitempty"`
+	Mode     string `json:"Mode,omitempty"` // octal, default "0644"
+}
+
+// Process is an entry in the supervised process list. The Main entry, or
+// the image workload if there is none, decides the VM's lifecycle; the
+// others are sidecars. Empty fields of the Main entry fall back to the
+// workload's argv, user and working directory.
+type Process struct {
+	Name       string            `json:"Name"`
+	Cmd        []string          `json:"Cmd,omitempty"`
+	Env        map[string]string `json:"Env,omitempty"` // on top of ExtraEnv
+	User       string            `json:"User,omitempty"`
+	WorkingDir string            `json:"WorkingDir,omitempty"`
+	Restart    *RestartPolicy    `json:"Restart,omitempty"`
+	Main       bool              `json:"Main,omitempty"`
+	DependsOn  []string          `json:"DependsOn,omitempty"`
+	Resources  *Resources        `json:"Resources,omitempty"` // sidecars only; own cgroup
+}
+
+type RestartPolicy struct {
+	Policy     string `json:"Policy,omitempty"`     // never (default), on-failure or always
+	MaxRetries int    `json:"MaxRetries,omitempty"` // on-failure only; 0 is unlimited
+}
+
 func Load(path string) (*RunConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -62,6 +249,26 @@ func Load(path string) (*RunConfig, error) {
 	return &cfg, nil
 }
 
+// NewMount reports whether the workload gets its own mount namespace.
+func (n *Namespaces) NewMount() bool {
+	return n != nil && (n.Mount || n.PID || n.IPC)
+}
+
+// HasResources reports whether any cgroup limits are configured: for the
+// workload, exec sessions or a sidecar. Controllers are only delegated to
+// cgroup2 when there are.
+func (c *RunConfig) HasResources() bool {
+	if c.Resources != nil || c.ExecResources != nil {
+		return true
+	}
+	for _, p := range c.Processes {
+		if p.Resources != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *RunConfig) RootDev() string {
 	if c.RootDevice != nil && *c.RootDevice != "" {
 		return *c.RootDevice
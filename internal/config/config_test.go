@@ -129,6 +129,26 @@ func TestRootDev_EmptyStringFallsBack(t *testing.T) {
 	}
 }
 
+func TestHasResources(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  RunConfig
+		want bool
+	}{
+		{"none", RunConfig{Processes: []Process{{Name: "db", Cmd: []string{"db"}}}}, false},
+		{"workload", RunConfig{Resources: &Resources{MemoryMax: 1 << 30}}, true},
+		{"exec", RunConfig{ExecResources: &Resources{PidsMax: 64}}, true},
+		{"sidecar only", RunConfig{Processes: []Process{
+			{Name: "app", Main: true},
+			{Name: "db", Cmd: []string{"db"}, Resources: &Resources{MemoryMax: 256 << 20}},
+		}}, true},
+	} {
+		if got := tt.cfg.HasResources(); got != tt.want {
+			t.Errorf("%s: HasResources() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
 func TestRunConfig_JSONRoundTrip(t *testing.T) {
 	override := "run"
 	user := "app:app"
@@ -183,7 +203,7 @@ func TestRunConfig_JSONRoundTrip(t *testing.T) {
 
 func TestRunConfig_PascalCaseFieldNames(t *testing.T) {
 	data := []byte(`{
-		"ImageConfig": {"Entrypoint": ["/bin/sh"], "Cmd": ["-c", "echo hi"]},
+		"ImageConfig": {"Entrypoint": ["/bin/sh"], "Cmd": ["-c", "echo hi"], "Labels": {"app": "web"}},
 		"ExecOverride": ["/bin/custom"],
 		"CmdOverride": "test",
 		"UserOverride": "nobody",
@@ -213,4 +233,7 @@ func TestRunConfig_PascalCaseFieldNames(t *testing.T) {
 	if len(cfg.EtcHosts) != 1 || cfg.EtcHosts[0].Desc != "database" {
 		t.Errorf("EtcHosts: got %v", cfg.EtcHosts)
 	}
+	if cfg.ImageConfig.Labels["app"] != "web" {
+		t.Errorf("Labels: got %v", cfg.ImageConfig.Labels)
+	}
 }
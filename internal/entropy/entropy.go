@@ -0,0 +1,50 @@
+package entropy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const randomDev = "/dev/urandom"
+
+// Seed mixes data into the kernel pool and credits it as full entropy via
+// RNDADDENTROPY. Returns the pool's entropy count (bits) before and after.
+// Uses ioctls on /dev/urandom so it works before /proc is mounted.
+func Seed(data []byte) (int, int, error) {
+	fd, err := unix.Open(randomDev, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return 0, 0, fmt.Errorf("open %s: %w", randomDev, err)
+	}
+	defer unix.Close(fd)
+
+	before, err := unix.IoctlGetInt(fd, unix.RNDGETENTCNT)
+	if err != nil {
+		return 0, 0, fmt.Errorf("RNDGETENTCNT: %w", err)
+	}
+
+	info := poolInfo(data)
+	defer clear(info)
+
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.RNDADDENTROPY, uintptr(unsafe.Pointer(&info[0]))); errno != 0 {
+		return before, before, fmt.Errorf("RNDADDENTROPY: %w", errno)
+	}
+
+	after, err := unix.IoctlGetInt(fd, unix.RNDGETENTCNT)
+	if err != nil {
+		return before, 0, fmt.Errorf("RNDGETENTCNT: %w", err)
+	}
+	return before, after, nil
+}
+
+// poolInfo builds the RNDADDENTROPY argument crediting all of data:
+// struct rand_pool_info { int entropy_count; int buf_size; __u32 buf[]; }
+func poolInfo(data []byte) []byte {
+	info := make([]byte, 8+len(data))
+	binary.NativeEndian.PutUint32(info[0:], uint32(len(data)*8))
+	binary.NativeEndian.PutUint32(info[4:], uint32(len(data)))
+	copy(info[8:], data)
+	return info
+}
@@ -0,0 +1,25 @@
+package entropy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestPoolInfo(t *testing.T) {
+	data := []byte("0123456789abcdef0123456789abcdef")
+	info := poolInfo(data)
+
+	if len(info) != 8+len(data) {
+		t.Fatalf("len: got %d, want %d", len(info), 8+len(data))
+	}
+	if got := binary.NativeEndian.Uint32(info[0:]); got != 256 {
+		t.Errorf("entropy_count: got %d bits, want 256", got)
+	}
+	if got := binary.NativeEndian.Uint32(info[4:]); got != 32 {
+		t.Errorf("buf_size: got %d bytes, want 32", got)
+	}
+	if !bytes.Equal(info[8:], data) {
+		t.Errorf("buf: got %q, want %q", info[8:], data)
+	}
+}
@@ -0,0 +1,190 @@
+package etc
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// caLayout is where a distro keeps its trust bundle and local anchors.
+type caLayout struct {
+	name    string
+	marker  string // file identifying the distro
+	bundle  string
+	anchors string // picked up by the distro's update tool
+	ext     string
+}
+
+var caLayouts = []caLayout{
+	{"alpine", "/etc/alpine-release", "/etc/ssl/certs/ca-certificates.crt", "/usr/local/share/ca-certificates", ".crt"},
+	{"debian", "/etc/debian_version", "/etc/ssl/certs/ca-certificates.crt", "/usr/local/share/ca-certificates", ".crt"},
+	{"rhel", "/etc/redhat-release", "/etc/pki/tls/certs/ca-bundle.crt", "/etc/pki/ca-trust/source/anchors", ".pem"},
+}
+
+// fallbackLayout is used when no distro is recognized; a missing bundle is
+// created with only the configured certificates.
+var fallbackLayout = caLayouts[1]
+
+// Init's certificates live in a marked section of the bundle, rewritten on
+// each boot so certificates removed from the config stop being trusted.
+const (
+	caSectionBegin = "# BEGIN pigeon-init CA certificates\n"
+	caSectionEnd   = "# END pigeon-init CA certificates\n"
+)
+
+// InstallCACertificates installs PEM certificates in the distro's trust
+// bundle and saves each as a local anchor, so the distro's update tool keeps
+// them. Certificates and anchors from earlier boots that are no longer
+// configured are removed. Returns the bundle path for SSL_CERT_FILE, or ""
+// without certificates.
+func InstallCACertificates(certs []string) (string, error) {
+	return installCACertificates("/", certs)
+}
+
+func installCACertificates(root string, certs []string) (string, error) {
+	blocks, err := parseCerts(certs)
+	if err != nil {
+		return "", err
+	}
+
+	layout := detectCALayout(root)
+	if err := writeBundle(filepath.Join(root, layout.bundle), blocks); err != nil {
+		return "", fmt.Errorf("write %s: %w", layout.bundle, err)
+	}
+	if err := writeAnchors(filepath.Join(root, layout.anchors), layout.ext, blocks); err != nil {
+		return "", fmt.Errorf("write anchors: %w", err)
+	}
+	if len(blocks) == 0 {
+		return "", nil
+	}
+	return layout.bundle, nil
+}
+
+// writeBundle replaces init's section of the bundle at path with blocks,
+// leaving the distro's certificates alone. Blocks the bundle already has
+// outside the section aren't repeated. The file is only rewritten when it
+// changes, in place of the file a symlinked bundle points to.
+func writeBundle(path string, blocks [][]byte) error {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	out := stripSection(existing)
+	var section []byte
+	for _, b := range blocks {
+		if !bytes.Contains(out, b) {
+			section = append(section, b...)
+		}
+	}
+	if len(section) > 0 {
+		if len(out) > 0 && out[len(out)-1] != '\n' {
+			out = append(out, '\n')
+		}
+		out = append(out, caSectionBegin...)
+		out = append(out, section...)
+		out = append(out, caSectionEnd...)
+	}
+	if bytes.Equal(out, existing) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".pigeon-tmp"
+	if err := os.WriteFile(tmp, out, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// stripSection returns a copy of bundle without init's section.
+func stripSection(bundle []byte) []byte {
+	out := append([]byte(nil), bundle...)
+	begin := bytes.Index(out, []byte(caSectionBegin))
+	if begin < 0 {
+		return out
+	}
+	end := len(out)
+	if i := bytes.Index(out[begin:], []byte(caSectionEnd)); i >= 0 {
+		end = begin + i + len(caSectionEnd)
+	}
+	return append(out[:begin], out[end:]...)
+}
+
+// writeAnchors saves blocks as pigeon-N anchors in dir and removes the
+// pigeon-N anchors of earlier boots beyond them.
+func writeAnchors(dir, ext string, blocks [][]byte) error {
+	if len(blocks) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	for i, b := range blocks {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("pigeon-%d%s", i, ext)), b, 0644); err != nil {
+			return err
+		}
+	}
+	existing, _ := filepath.Glob(filepath.Join(dir, "pigeon-*"+ext))
+	for _, path := range existing {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "pigeon-"), ext))
+		if err != nil || n < len(blocks) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseCerts validates each entry and returns its certificates re-encoded
+// as PEM, so the bundle check doesn't depend on formatting.
+func parseCerts(certs []string) ([][]byte, error) {
+	var out [][]byte
+	for i, c := range certs {
+		rest := []byte(c)
+		n := 0
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				return nil, fmt.Errorf("CA certificate %d: unexpected PEM block %q", i, block.Type)
+			}
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, fmt.Errorf("CA certificate %d: %w", i, err)
+			}
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes}))
+			n++
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("CA certificate %d: no PEM certificate found", i)
+		}
+	}
+	return out, nil
+}
+
+func detectCALayout(root string) caLayout {
+	for _, l := range caLayouts {
+		if _, err := os.Stat(filepath.Join(root, l.marker)); err == nil {
+			return l
+		}
+	}
+	for _, l := range caLayouts {
+		if _, err := os.Stat(filepath.Join(root, l.bundle)); err == nil {
+			return l
+		}
+	}
+	return fallbackLayout
+}
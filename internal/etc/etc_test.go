@@ -3,7 +3,10 @@
 package etc
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/pigeon-as/pigeon-init/internal/config"
 )
@@ -31,3 +34,107 @@ func TestWriteResolv_EmptyNameserversIsNoop(t *testing.T) {
 		t.Errorf("WriteResolv(empty): %v", err)
 	}
 }
+
+func TestSetTimezone_EmptyIsNoop(t *testing.T) {
+	env, err := SetTimezone("")
+	if err != nil || env != "" {
+		t.Errorf("SetTimezone(empty): got (%q, %v)", env, err)
+	}
+}
+
+func TestSetTimezone_Invalid(t *testing.T) {
+	for _, tz := range []string{"../etc/passwd", "/usr/share/zoneinfo/UTC", "Europe//Paris"} {
+		if _, err := SetTimezone(tz); err == nil {
+			t.Errorf("SetTimezone(%q): expected error", tz)
+		}
+	}
+}
+
+// withTimezonePaths points SetTimezone at a temp root with zoneinfo for
+// zones.
+func withTimezonePaths(t *testing.T, zones ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	origZone, origLocal, origTZ := zoneinfoDir, localtimePath, timezonePath
+	zoneinfoDir = filepath.Join(root, "zoneinfo")
+	localtimePath = filepath.Join(root, "etc", "localtime")
+	timezonePath = filepath.Join(root, "etc", "timezone")
+	t.Cleanup(func() { zoneinfoDir, localtimePath, timezonePath = origZone, origLocal, origTZ })
+	for _, z := range zones {
+		path := filepath.Join(zoneinfoDir, z)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("TZif"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestSetTimezone_FromRootfs(t *testing.T) {
+	withTimezonePaths(t, "Europe/Paris")
+
+	env, err := SetTimezone("Europe/Paris")
+	if err != nil || env != "Europe/Paris" {
+		t.Fatalf("SetTimezone: got (%q, %v)", env, err)
+	}
+	if target, _ := os.Readlink(localtimePath); target != filepath.Join(zoneinfoDir, "Europe/Paris") {
+		t.Errorf("localtime -> %q", target)
+	}
+}
+
+func TestSetTimezone_FromEmbeddedTZData(t *testing.T) {
+	withTimezonePaths(t)
+
+	env, err := SetTimezone("Asia/Tokyo")
+	if err != nil || env != ":"+localtimePath {
+		t.Fatalf("SetTimezone: got (%q, %v)", env, err)
+	}
+	data, err := os.ReadFile(localtimePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := time.LoadLocationFromTZData("Asia/Tokyo", data)
+	if err != nil {
+		t.Fatalf("parse localtime: %v", err)
+	}
+	if _, offset := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone(); offset != 9*3600 {
+		t.Errorf("offset: got %d, want %d", offset, 9*3600)
+	}
+}
+
+func TestSetTimezone_UnknownKeepsLocaltime(t *testing.T) {
+	withTimezonePaths(t, "UTC")
+	if _, err := SetTimezone("UTC"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SetTimezone("Mars/Olympus_Mons"); err == nil {
+		t.Fatal("SetTimezone(unknown): expected error")
+	}
+	if target, _ := os.Readlink(localtimePath); target != filepath.Join(zoneinfoDir, "UTC") {
+		t.Errorf("localtime -> %q, want the previous zone", target)
+	}
+}
+
+func TestEncodeTZif(t *testing.T) {
+	for _, name := range []string{"Europe/Paris", "America/New_York", "Australia/Lord_Howe", "UTC"} {
+		want, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := time.LoadLocationFromTZData(name, encodeTZif(want))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", name, err)
+		}
+		for tm := time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC); tm.Year() < 2037; tm = tm.Add(89 * 24 * time.Hour) {
+			wantName, wantOffset := tm.In(want).Zone()
+			gotName, gotOffset := tm.In(got).Zone()
+			if gotName != wantName || gotOffset != wantOffset {
+				t.Errorf("%s at %v: got %s%+d, want %s%+d", name, tm, gotName, gotOffset, wantName, wantOffset)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package etc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	_ "time/tzdata" // fallback for zones missing from the rootfs
+)
+
+var (
+	zoneinfoDir   = "/usr/share/zoneinfo"
+	localtimePath = "/etc/localtime"
+	timezonePath  = "/etc/timezone"
+)
+
+// SetTimezone points /etc/localtime at tz and returns the TZ value for the
+// workload env. Zones missing from the rootfs are written from the Go tzdata
+// embedded in init, in which case TZ names /etc/localtime directly. The zone
+// is resolved before anything is replaced, so an unknown zone leaves the
+// image's localtime alone.
+func SetTimezone(tz string) (string, error) {
+	if tz == "" {
+		return "", nil
+	}
+	if !validZone(tz) {
+		return "", fmt.Errorf("invalid timezone %q", tz)
+	}
+
+	env := tz
+	zone := filepath.Join(zoneinfoDir, tz)
+	var data []byte
+	if info, err := os.Stat(zone); err != nil || !info.Mode().IsRegular() {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return "", fmt.Errorf("unknown timezone %q", tz)
+		}
+		data = encodeTZif(loc)
+		env = ":" + localtimePath
+	}
+
+	dir := filepath.Dir(localtimePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp := filepath.Join(dir, ".localtime.tmp")
+	_ = os.Remove(tmp)
+	if data == nil {
+		if err := os.Symlink(zone, tmp); err != nil {
+			return "", fmt.Errorf("symlink %s: %w", localtimePath, err)
+		}
+	} else if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", fmt.Errorf("write %s: %w", localtimePath, err)
+	}
+	if err := os.Rename(tmp, localtimePath); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("replace %s: %w", localtimePath, err)
+	}
+
+	if err := os.WriteFile(timezonePath, []byte(tz+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("write %s: %w", timezonePath, err)
+	}
+	return env, nil
+}
+
+func validZone(tz string) bool {
+	if strings.HasPrefix(tz, "/") {
+		return false
+	}
+	for _, part := range strings.Split(tz, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package etc
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// tzifEnd is where encodeTZif stops listing transitions: the end of the
+// 32-bit range version 1 files can hold.
+var tzifEnd = time.Unix(math.MaxInt32, 0)
+
+type tzifType struct {
+	offset int32
+	isDST  bool
+	abbrev string
+}
+
+// encodeTZif writes loc as a version 1 TZif file (RFC 8536), as read by
+// glibc and musl. Transitions are found with ZoneBounds from the start of
+// the 32-bit range.
+func encodeTZif(loc *time.Location) []byte {
+	var types []tzifType
+	typeIndex := func(t time.Time) uint8 {
+		name, offset := t.Zone()
+		tt := tzifType{int32(offset), t.IsDST(), name}
+		for i, x := range types {
+			if x == tt {
+				return uint8(i)
+			}
+		}
+		types = append(types, tt)
+		return uint8(len(types) - 1)
+	}
+
+	// Type 0 is local time before the first transition.
+	t := time.Unix(math.MinInt32, 0).In(loc)
+	typeIndex(t)
+	var times []int32
+	var indices []uint8
+	for {
+		_, end := t.ZoneBounds()
+		if end.IsZero() || end.After(tzifEnd) {
+			break
+		}
+		times = append(times, int32(end.Unix()))
+		indices = append(indices, typeIndex(end))
+		t = end
+	}
+
+	var chars []byte
+	abbrevIndex := make(map[string]uint8)
+	for _, tt := range types {
+		if _, ok := abbrevIndex[tt.abbrev]; !ok {
+			abbrevIndex[tt.abbrev] = uint8(len(chars))
+			chars = append(append(chars, tt.abbrev...), 0)
+		}
+	}
+
+	out := []byte("TZif")
+	out = append(out, make([]byte, 16)...) // version 1, reserved
+	for _, n := range []int{0, 0, 0, len(times), len(types), len(chars)} {
+		out = binary.BigEndian.AppendUint32(out, uint32(n))
+	}
+	for _, tm := range times {
+		out = binary.BigEndian.AppendUint32(out, uint32(tm))
+	}
+	out = append(out, indices...)
+	for _, tt := range types {
+		out = binary.BigEndian.AppendUint32(out, uint32(tt.offset))
+		dst := byte(0)
+		if tt.isDST {
+			dst = 1
+		}
+		out = append(out, dst, abbrevIndex[tt.abbrev])
+	}
+	return append(out, chars...)
+}
@@ -0,0 +1,258 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/process"
+)
+
+// Docker defaults.
+const (
+	defaultInterval      = 30 * time.Second
+	defaultTimeout       = 30 * time.Second
+	defaultStartInterval = 5 * time.Second
+	defaultRetries       = 3
+
+	maxOutput = 4096
+	maxLog    = 5
+)
+
+const (
+	Starting  = "starting"
+	Healthy   = "healthy"
+	Unhealthy = "unhealthy"
+)
+
+type Result struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ExitCode int       `json:"exit_code"` // -1 on timeout or spawn failure
+	Output   string    `json:"output"`
+}
+
+type Status struct {
+	Status        string   `json:"status"`
+	FailingStreak int      `json:"failing_streak"`
+	Log           []Result `json:"log,omitempty"` // most recent last
+}
+
+// Checker runs an image healthcheck against the workload, the way Docker
+// does inside a container.
+type Checker struct {
+	argv          []string
+	interval      time.Duration
+	timeout       time.Duration
+	startPeriod   time.Duration
+	startInterval time.Duration
+	retries       int
+
+	sup    *process.Supervisor
+	spec   process.Spec
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewChecker returns a checker for hc, or nil if hc is absent or its test
+// is NONE. Checks are spawned per spec in the workload's namespaces.
+func NewChecker(hc *config.Healthcheck, sup *process.Supervisor, spec process.Spec, logger *slog.Logger) (*Checker, error) {
+	if hc == nil || len(hc.Test) == 0 || hc.Test[0] == "NONE" {
+		return nil, nil
+	}
+	argv, err := testArgv(hc.Test)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range []time.Duration{hc.Interval, hc.Timeout, hc.StartPeriod, hc.StartInterval} {
+		if d < 0 {
+			return nil, fmt.Errorf("negative healthcheck duration %s", d)
+		}
+	}
+	if hc.Retries < 0 {
+		return nil, fmt.Errorf("negative healthcheck retries %d", hc.Retries)
+	}
+	c := &Checker{
+		argv:          argv,
+		interval:      orDefault(hc.Interval, defaultInterval),
+		timeout:       orDefault(hc.Timeout, defaultTimeout),
+		startPeriod:   hc.StartPeriod,
+		startInterval: orDefault(hc.StartInterval, defaultStartInterval),
+		retries:       hc.Retries,
+		sup:           sup,
+		spec:          spec,
+		logger:        logger,
+		status:        Status{Status: Starting},
+	}
+	if c.retries == 0 {
+		c.retries = defaultRetries
+	}
+	return c, nil
+}
+
+// testArgv converts a Docker test ("CMD", args...) or ("CMD-SHELL", cmd).
+func testArgv(test []string) ([]string, error) {
+	switch test[0] {
+	case "CMD":
+		if len(test) < 2 {
+			return nil, errors.New("healthcheck CMD without a command")
+		}
+		return test[1:], nil
+	case "CMD-SHELL":
+		if len(test) != 2 {
+			return nil, errors.New("healthcheck CMD-SHELL takes one command string")
+		}
+		return []string{"/bin/sh", "-c", test[1]}, nil
+	default:
+		return nil, fmt.Errorf("unknown healthcheck test type %q", test[0])
+	}
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+func (c *Checker) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.status
+	st.Log = append([]Result(nil), c.status.Log...)
+	return st
+}
+
+// Run checks the workload until ctx is done or it exits. Probes run every
+// interval, or every start interval during the start period, where failures
+// don't count towards retries.
+func (c *Checker) Run(ctx context.Context) {
+	started := time.Now()
+	for {
+		inStart := time.Since(started) < c.startPeriod
+		wait := c.interval
+		if inStart {
+			wait = c.startInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.sup.WaitResult():
+			return
+		case <-time.After(wait):
+		}
+		c.record(c.probe(ctx), time.Since(started) < c.startPeriod)
+	}
+}
+
+func (c *Checker) record(res Result, inStart bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Log = append(c.status.Log, res)
+	if len(c.status.Log) > maxLog {
+		c.status.Log = c.status.Log[len(c.status.Log)-maxLog:]
+	}
+
+	prev := c.status.Status
+	if res.ExitCode == 0 {
+		c.status.Status = Healthy
+		c.status.FailingStreak = 0
+	} else if !inStart || prev != Starting {
+		c.status.FailingStreak++
+		if c.status.FailingStreak >= c.retries {
+			c.status.Status = Unhealthy
+		}
+	}
+	if c.status.Status != prev {
+		c.logger.Info("health status changed", "status", c.status.Status, "exit_code", res.ExitCode, "output", res.Output)
+	}
+}
+
+// probe runs the test once. Like an exec session it is started under the
+// supervisor lock and registered with the reap loop, which reports its exit.
+func (c *Checker) probe(ctx context.Context) Result {
+	res := Result{Start: time.Now(), ExitCode: -1}
+	fail := func(err error) Result {
+		res.End, res.Output = time.Now(), err.Error()
+		return res
+	}
+	spec := c.spec
+	j, err := c.sup.Join()
+	if err != nil {
+		return fail(err)
+	}
+	spec.Join = j
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return fail(err)
+	}
+	defer pr.Close()
+	cmd := spec.Command(context.Background(), c.argv)
+	cmd.Stdout, cmd.Stderr = pw, pw
+	cmd.SysProcAttr.Setpgid = true
+
+	c.sup.Lock()
+	err = cmd.Start()
+	var exitCh <-chan unix.WaitStatus
+	if err == nil {
+		exitCh = c.sup.RegisterExec(cmd.Process.Pid)
+	}
+	c.sup.Unlock()
+	pw.Close()
+	if err != nil {
+		return fail(err)
+	}
+	pid := cmd.Process.Pid
+	defer c.sup.UnregisterExec(pid)
+
+	output := make(chan []byte, 1)
+	go func() {
+		out, _ := io.ReadAll(pr)
+		output <- out
+	}()
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	var ws unix.WaitStatus
+	select {
+	case ws = <-exitCh:
+	case <-timer.C:
+		_ = unix.Kill(-pid, unix.SIGKILL)
+		res.End, res.Output = time.Now(), fmt.Sprintf("health check exceeded timeout (%s)", c.timeout)
+		return res
+	case <-ctx.Done():
+		_ = unix.Kill(-pid, unix.SIGKILL)
+		return fail(ctx.Err())
+	}
+	res.End = time.Now()
+
+	// Background processes may hold the pipe open; don't wait on them long.
+	var out []byte
+	select {
+	case out = <-output:
+	case <-time.After(time.Second):
+	}
+	if len(out) > maxOutput {
+		out = out[:maxOutput]
+	}
+	res.Output = string(out)
+
+	if ws.Signaled() {
+		res.Output = "health check killed by " + unix.SignalName(ws.Signal())
+	} else {
+		res.ExitCode = ws.ExitStatus()
+	}
+	return res
+}
@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/process"
+)
+
+// Probes re-execute /proc/self/exe, which is the test binary here.
+func TestMain(m *testing.M) {
+	if process.IsChild() {
+		process.ChildMain()
+	}
+	os.Exit(m.Run())
+}
+
+func newTestChecker(t *testing.T, hc *config.Healthcheck) *Checker {
+	t.Helper()
+	c, err := NewChecker(hc, nil, process.Spec{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	return c
+}
+
+func TestNewChecker_Disabled(t *testing.T) {
+	for _, hc := range []*config.Healthcheck{nil, {}, {Test: []string{"NONE"}}} {
+		if c := newTestChecker(t, hc); c != nil {
+			t.Errorf("NewChecker(%+v): expected nil", hc)
+		}
+	}
+}
+
+func TestNewChecker_Defaults(t *testing.T) {
+	c := newTestChecker(t, &config.Healthcheck{Test: []string{"CMD-SHELL", "curl -f localhost"}})
+	if want := []string{"/bin/sh", "-c", "curl -f localhost"}; !reflect.DeepEqual(c.argv, want) {
+		t.Errorf("argv: got %q, want %q", c.argv, want)
+	}
+	if c.interval != 30*time.Second || c.timeout != 30*time.Second || c.retries != 3 {
+		t.Errorf("defaults: interval=%s timeout=%s retries=%d", c.interval, c.timeout, c.retries)
+	}
+	if c.Status().Status != Starting {
+		t.Errorf("initial status: got %q, want %q", c.Status().Status, Starting)
+	}
+}
+
+func TestNewChecker_Invalid(t *testing.T) {
+	for _, hc := range []*config.Healthcheck{
+		{Test: []string{"CMD"}},
+		{Test: []string{"CMD-SHELL", "a", "b"}},
+		{Test: []string{"curl", "-f", "localhost"}},
+		{Test: []string{"CMD", "true"}, Interval: -time.Second},
+		{Test: []string{"CMD", "true"}, Retries: -1},
+	} {
+		if _, err := NewChecker(hc, nil, process.Spec{}, nil); err == nil {
+			t.Errorf("NewChecker(%+v): expected error", hc)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	c := newTestChecker(t, &config.Healthcheck{Test: []string{"CMD", "true"}, Retries: 2})
+	fail, ok := Result{ExitCode: 1}, Result{ExitCode: 0}
+
+	steps := []struct {
+		res     Result
+		inStart bool
+		want    string
+		streak  int
+	}{
+		{fail, true, Starting, 0}, // ignored during the start period
+		{ok, true, Healthy, 0},
+		{fail, true, Healthy, 1}, // counts once healthy
+		{fail, false, Unhealthy, 2},
+		{ok, false, Healthy, 0},
+	}
+	for i, step := range steps {
+		c.record(step.res, step.inStart)
+		st := c.Status()
+		if st.Status != step.want || st.FailingStreak != step.streak {
+			t.Fatalf("step %d: got %s/%d, want %s/%d", i, st.Status, st.FailingStreak, step.want, step.streak)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		c.record(ok, false)
+	}
+	if n := len(c.Status().Log); n != maxLog {
+		t.Errorf("log length: got %d, want %d", n, maxLog)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sup, err := process.New([]string{"sleep", "60"}, process.Spec{}, logger)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := sup.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	done := make(chan process.Result)
+	go func() { done <- sup.Run() }()
+	defer func() {
+		sup.SignalCh <- syscall.SIGKILL
+		<-done
+	}()
+
+	c, err := NewChecker(&config.Healthcheck{Test: []string{"CMD-SHELL", "echo unhealthy; exit 3"}}, sup, process.Spec{}, logger)
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	// The reap loop reports the probe's exit, so it must not be blocked.
+	if res := c.probe(context.Background()); res.ExitCode != 3 || res.Output != "unhealthy\n" {
+		t.Errorf("probe: got %+v, want exit 3 with its output", res)
+	}
+
+	c.argv, c.timeout = []string{"sleep", "10"}, 100*time.Millisecond
+	if res := c.probe(context.Background()); res.ExitCode != -1 || res.End.Sub(res.Start) > 5*time.Second {
+		t.Errorf("probe: got %+v, want a timeout", res)
+	}
+}
@@ -0,0 +1,229 @@
+package kmod
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	modulesDir = "/lib/modules"
+	sysModule  = "/sys/module"
+
+	insertModule = insmod // replaced in tests
+)
+
+// decompressors are the rootfs tools used for modules the kernel can't
+// decompress itself; gzip is handled in process.
+var decompressors = map[string][]string{
+	".xz":  {"xz", "-dc"},
+	".zst": {"zstd", "-dc"},
+}
+
+type module struct {
+	path string   // relative to the release directory
+	deps []string // as listed in modules.dep
+}
+
+type loader struct {
+	dir     string
+	modules map[string]module
+	builtin map[string]bool
+	loaded  map[string]bool
+	logger  *slog.Logger
+}
+
+// Load inserts each module and its dependencies from
+// /lib/modules/<release>, resolved through modules.dep. Entries are a
+// module name optionally followed by parameters ("loop max_loop=64").
+// Failures are returned per module name; other modules are still loaded.
+func Load(specs []string, logger *slog.Logger) map[string]error {
+	failed := make(map[string]error)
+	if len(specs) == 0 {
+		return failed
+	}
+	fail := func(err error) map[string]error {
+		for _, spec := range specs {
+			name, _, _ := strings.Cut(strings.TrimSpace(spec), " ")
+			failed[name] = err
+		}
+		return failed
+	}
+
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return fail(fmt.Errorf("uname: %w", err))
+	}
+	dir := filepath.Join(modulesDir, unix.ByteSliceToString(uts.Release[:]))
+
+	modules, err := readDeps(filepath.Join(dir, "modules.dep"))
+	if err != nil {
+		return fail(err)
+	}
+	l := &loader{
+		dir:     dir,
+		modules: modules,
+		builtin: readBuiltin(filepath.Join(dir, "modules.builtin")),
+		loaded:  make(map[string]bool),
+		logger:  logger,
+	}
+
+	for _, spec := range specs {
+		name, params, _ := strings.Cut(strings.TrimSpace(spec), " ")
+		if err := l.load(normalize(name), strings.TrimSpace(params)); err != nil {
+			failed[name] = err
+		}
+	}
+	return failed
+}
+
+func (l *loader) load(name, params string) error {
+	if l.builtin[name] {
+		l.logger.Debug("module is built in", "module", name)
+		return nil
+	}
+	mod, ok := l.modules[name]
+	if !ok {
+		return fmt.Errorf("not found in modules.dep")
+	}
+
+	// modules.dep lists dependencies so the last one must be inserted first.
+	for i := len(mod.deps) - 1; i >= 0; i-- {
+		if err := l.insert(moduleName(mod.deps[i]), mod.deps[i], ""); err != nil {
+			return fmt.Errorf("dependency %s: %w", mod.deps[i], err)
+		}
+	}
+	return l.insert(name, mod.path, params)
+}
+
+func (l *loader) insert(name, path, params string) error {
+	if l.loaded[name] {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(sysModule, name, "initstate")); err == nil {
+		l.loaded[name] = true
+		return nil
+	}
+
+	if err := insertModule(filepath.Join(l.dir, path), params); err != nil && !errors.Is(err, unix.EEXIST) {
+		return err
+	}
+	l.loaded[name] = true
+	l.logger.Info("loaded kernel module", "module", name)
+	return nil
+}
+
+// insmod loads a module file. Compressed modules are decompressed by the
+// kernel (CONFIG_MODULE_DECOMPRESS); on kernels without it gzip is handled
+// here and xz or zstd by the rootfs tools.
+func insmod(path, params string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ext := filepath.Ext(path)
+	flags := 0
+	if ext != ".ko" {
+		flags = unix.MODULE_INIT_COMPRESSED_FILE
+	}
+	err = unix.FinitModule(int(f.Fd()), params, flags)
+	unsupported := errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP)
+	if ext == ".ko" || !unsupported {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	image, err := decompress(f, ext)
+	if err != nil {
+		return fmt.Errorf("decompress %s: %w", path, err)
+	}
+	return unix.InitModule(image, params)
+}
+
+func decompress(r io.Reader, ext string) ([]byte, error) {
+	if ext == ".gz" {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	}
+	argv, ok := decompressors[ext]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression %s", ext)
+	}
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return nil, fmt.Errorf("kernel can't decompress %s modules and %s is not in the rootfs", ext, argv[0])
+	}
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Stdin = r
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", argv[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func readDeps(path string) (map[string]module, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open modules.dep: %w", err)
+	}
+	defer f.Close()
+
+	modules := make(map[string]module)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		target, deps, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		modules[moduleName(target)] = module{path: target, deps: strings.Fields(deps)}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read modules.dep: %w", err)
+	}
+	return modules, nil
+}
+
+func readBuiltin(path string) map[string]bool {
+	builtin := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return builtin
+	}
+	for _, line := range strings.Fields(string(data)) {
+		builtin[moduleName(line)] = true
+	}
+	return builtin
+}
+
+// moduleName turns "kernel/drivers/md/dm-crypt.ko.xz" into "dm_crypt".
+func moduleName(path string) string {
+	base := filepath.Base(path)
+	if i := strings.Index(base, ".ko"); i >= 0 {
+		base = base[:i]
+	}
+	return normalize(base)
+}
+
+// normalize treats dashes and underscores in module names as equivalent.
+func normalize(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
@@ -0,0 +1,180 @@
+package kmod
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestReadDeps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modules.dep")
+	content := "kernel/drivers/net/wireguard/wireguard.ko.xz: kernel/net/ipv6/ip6_udp_tunnel.ko.xz kernel/net/ipv4/udp_tunnel.ko.xz\n" +
+		"kernel/net/ipv4/udp_tunnel.ko.xz:\n" +
+		"kernel/drivers/md/dm-crypt.ko: kernel/drivers/md/dm-mod.ko\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	modules, err := readDeps(path)
+	if err != nil {
+		t.Fatalf("readDeps: %v", err)
+	}
+	if len(modules) != 3 {
+		t.Fatalf("modules: got %d, want 3", len(modules))
+	}
+
+	wg := modules["wireguard"]
+	if wg.path != "kernel/drivers/net/wireguard/wireguard.ko.xz" {
+		t.Errorf("wireguard path: got %q", wg.path)
+	}
+	if len(wg.deps) != 2 || wg.deps[1] != "kernel/net/ipv4/udp_tunnel.ko.xz" {
+		t.Errorf("wireguard deps: got %v", wg.deps)
+	}
+	if len(modules["udp_tunnel"].deps) != 0 {
+		t.Errorf("udp_tunnel deps: got %v", modules["udp_tunnel"].deps)
+	}
+	if modules["dm_crypt"].path != "kernel/drivers/md/dm-crypt.ko" {
+		t.Errorf("dm_crypt: got %+v", modules["dm_crypt"])
+	}
+}
+
+func TestReadDeps_Missing(t *testing.T) {
+	if _, err := readDeps("/nonexistent/modules.dep"); err == nil {
+		t.Error("readDeps(missing): expected error")
+	}
+}
+
+func TestReadBuiltin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modules.builtin")
+	if err := os.WriteFile(path, []byte("kernel/fs/ext4/ext4.ko\nkernel/drivers/block/virtio_blk.ko\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builtin := readBuiltin(path)
+	if !builtin["ext4"] || !builtin["virtio_blk"] {
+		t.Errorf("readBuiltin: got %v", builtin)
+	}
+	if len(readBuiltin("/nonexistent")) != 0 {
+		t.Error("readBuiltin(missing): expected empty set")
+	}
+}
+
+func TestModuleName(t *testing.T) {
+	tests := map[string]string{
+		"kernel/drivers/md/dm-crypt.ko.xz":              "dm_crypt",
+		"kernel/fs/overlayfs/overlay.ko":                "overlay",
+		"kernel/drivers/net/wireguard/wireguard.ko.zst": "wireguard",
+		"kernel/lib/zlib_deflate/zlib_deflate.ko.gz":    "zlib_deflate",
+	}
+	for in, want := range tests {
+		if got := moduleName(in); got != want {
+			t.Errorf("moduleName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// withModules points Load at a fake release directory and records inserts.
+func withModules(t *testing.T, dep, builtin string, loaded ...string) *[]string {
+	t.Helper()
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	dir := filepath.Join(root, "lib", unix.ByteSliceToString(uts.Release[:]))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "modules.dep"), []byte(dep), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "modules.builtin"), []byte(builtin), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sys := filepath.Join(root, "sys")
+	for _, name := range loaded {
+		if err := os.MkdirAll(filepath.Join(sys, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sys, name, "initstate"), []byte("live\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var inserted []string
+	origDir, origSys, origInsert := modulesDir, sysModule, insertModule
+	modulesDir, sysModule = filepath.Join(root, "lib"), sys
+	insertModule = func(path, params string) error {
+		if strings.Contains(path, "broken") {
+			return unix.ENOEXEC
+		}
+		inserted = append(inserted, strings.TrimSpace(filepath.Base(path)+" "+params))
+		return nil
+	}
+	t.Cleanup(func() { modulesDir, sysModule, insertModule = origDir, origSys, origInsert })
+	return &inserted
+}
+
+func TestLoad_DependenciesFirst(t *testing.T) {
+	inserted := withModules(t,
+		"kernel/wireguard.ko.xz: kernel/ip6_udp_tunnel.ko.xz kernel/udp_tunnel.ko.xz\n"+
+			"kernel/udp_tunnel.ko.xz:\nkernel/ip6_udp_tunnel.ko.xz:\nkernel/loop.ko:\n",
+		"kernel/ext4.ko\n", "ip6_udp_tunnel")
+
+	failed := Load([]string{"wireguard", "loop max_loop=64", "ext4"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if len(failed) != 0 {
+		t.Fatalf("Load: %v", failed)
+	}
+	want := []string{"udp_tunnel.ko.xz", "wireguard.ko.xz", "loop.ko max_loop=64"}
+	if !reflect.DeepEqual(*inserted, want) {
+		t.Errorf("inserted %v, want %v", *inserted, want)
+	}
+}
+
+func TestLoad_ContinuesPastFailures(t *testing.T) {
+	inserted := withModules(t, "kernel/broken.ko:\nkernel/loop.ko:\n", "")
+
+	failed := Load([]string{"missing", "broken", "loop"}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if len(failed) != 2 || failed["missing"] == nil || failed["broken"] == nil {
+		t.Errorf("failed: got %v, want missing and broken", failed)
+	}
+	if !reflect.DeepEqual(*inserted, []string{"loop.ko"}) {
+		t.Errorf("inserted %v, want loop.ko", *inserted)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("module image"))
+	zw.Close()
+	got, err := decompress(&gz, ".gz")
+	if err != nil || string(got) != "module image" {
+		t.Errorf("gzip: got %q, %v", got, err)
+	}
+
+	if _, err := decompress(strings.NewReader(""), ".lz4"); err == nil {
+		t.Error("unknown compression: expected error")
+	}
+
+	xz, err := exec.LookPath("xz")
+	if err != nil {
+		t.Skip("xz not installed")
+	}
+	compressed, err := exec.Command("sh", "-c", "printf 'module image' | "+xz+" -c").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = decompress(bytes.NewReader(compressed), ".xz")
+	if err != nil || string(got) != "module image" {
+		t.Errorf("xz: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var memoryDir = "/sys/devices/system/memory"
+
+const (
+	PolicyOnline        = "online"
+	PolicyOnlineMovable = "online_movable"
+)
+
+type Stat struct {
+	BlockSize     uint64 `json:"block_size"`
+	OnlineBlocks  int    `json:"online_blocks"`
+	OfflineBlocks int    `json:"offline_blocks"`
+	OnlineBytes   uint64 `json:"online_bytes"`
+}
+
+// ReadStat summarises memory block state from sysfs.
+func ReadStat() (Stat, error) {
+	var st Stat
+	data, err := os.ReadFile(filepath.Join(memoryDir, "block_size_bytes"))
+	if err != nil {
+		return st, fmt.Errorf("read block size: %w", err)
+	}
+	st.BlockSize, err = strconv.ParseUint(strings.TrimSpace(string(data)), 16, 64)
+	if err != nil {
+		return st, fmt.Errorf("parse block size: %w", err)
+	}
+
+	blocks, err := filepath.Glob(filepath.Join(memoryDir, "memory[0-9]*"))
+	if err != nil {
+		return st, err
+	}
+	for _, b := range blocks {
+		state, err := os.ReadFile(filepath.Join(b, "state"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(state)) == "offline" {
+			st.OfflineBlocks++
+		} else {
+			st.OnlineBlocks++
+		}
+	}
+	st.OnlineBytes = uint64(st.OnlineBlocks) * st.BlockSize
+	return st, nil
+}
+
+// Watch onlines memory blocks hot-added by virtio-mem (or any other
+// hotplug source) according to policy until ctx is done. Blocks that are
+// already offline when Watch starts are onlined first.
+func Watch(ctx context.Context, policy string, logger *slog.Logger) error {
+	if policy == "" {
+		policy = PolicyOnlineMovable
+	}
+	if policy != PolicyOnline && policy != PolicyOnlineMovable {
+		return fmt.Errorf("invalid memory online policy %q", policy)
+	}
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return fmt.Errorf("uevent socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("uevent bind: %w", err)
+	}
+	sock := os.NewFile(uintptr(fd), "uevent")
+	defer sock.Close()
+	go func() {
+		<-ctx.Done()
+		sock.Close()
+	}()
+
+	onlineOffline(policy, logger)
+
+	buf := make([]byte, 16384)
+	for {
+		n, err := sock.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("uevent read: %w", err)
+		}
+		ev := parseUevent(buf[:n])
+		if ev["SUBSYSTEM"] != "memory" || ev["ACTION"] != "add" {
+			continue
+		}
+		block := filepath.Base(ev["DEVPATH"])
+		if err := online(block, policy); err != nil {
+			logger.Warn("online memory block failed", "block", block, "err", err)
+			continue
+		}
+		logOnline(block, logger)
+	}
+}
+
+func onlineOffline(policy string, logger *slog.Logger) {
+	blocks, _ := filepath.Glob(filepath.Join(memoryDir, "memory[0-9]*"))
+	for _, b := range blocks {
+		state, err := os.ReadFile(filepath.Join(b, "state"))
+		if err != nil || strings.TrimSpace(string(state)) != "offline" {
+			continue
+		}
+		block := filepath.Base(b)
+		if err := online(block, policy); err != nil {
+			logger.Warn("online memory block failed", "block", block, "err", err)
+			continue
+		}
+		logOnline(block, logger)
+	}
+}
+
+func online(block, policy string) error {
+	path := filepath.Join(memoryDir, block, "state")
+	state, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(state)) != "offline" {
+		return nil
+	}
+	return os.WriteFile(path, []byte(policy), 0644)
+}
+
+func logOnline(block string, logger *slog.Logger) {
+	st, err := ReadStat()
+	if err != nil {
+		logger.Info("memory block online", "block", block)
+		return
+	}
+	logger.Info("memory block online", "block", block, "online_mb", st.OnlineBytes>>20, "offline_blocks", st.OfflineBlocks)
+}
+
+// parseUevent decodes "ACTION@DEVPATH\0KEY=VALUE\0..." into its keys.
+func parseUevent(msg []byte) map[string]string {
+	ev := make(map[string]string)
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		if k, v, ok := strings.Cut(string(field), "="); ok {
+			ev[k] = v
+		}
+	}
+	return ev
+}
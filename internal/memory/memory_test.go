@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func withMemoryDir(t *testing.T, states map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "block_size_bytes"), []byte("8000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for block, state := range states {
+		if err := os.MkdirAll(filepath.Join(dir, block), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, block, "state"), []byte(state+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orig := memoryDir
+	memoryDir = dir
+	t.Cleanup(func() { memoryDir = orig })
+	return dir
+}
+
+func TestReadStat(t *testing.T) {
+	withMemoryDir(t, map[string]string{
+		"memory0": "online",
+		"memory1": "online",
+		"memory2": "offline",
+	})
+
+	st, err := ReadStat()
+	if err != nil {
+		t.Fatalf("ReadStat: %v", err)
+	}
+	if st.BlockSize != 128<<20 {
+		t.Errorf("BlockSize: got %d, want %d", st.BlockSize, 128<<20)
+	}
+	if st.OnlineBlocks != 2 || st.OfflineBlocks != 1 {
+		t.Errorf("blocks: got %d online, %d offline", st.OnlineBlocks, st.OfflineBlocks)
+	}
+	if st.OnlineBytes != 256<<20 {
+		t.Errorf("OnlineBytes: got %d, want %d", st.OnlineBytes, 256<<20)
+	}
+}
+
+func TestOnline(t *testing.T) {
+	dir := withMemoryDir(t, map[string]string{"memory0": "online", "memory5": "offline"})
+
+	if err := online("memory5", PolicyOnlineMovable); err != nil {
+		t.Fatalf("online: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "memory5", "state"))
+	if string(got) != "online_movable" {
+		t.Errorf("memory5 state: got %q, want online_movable", got)
+	}
+
+	if err := online("memory0", PolicyOnline); err != nil {
+		t.Fatalf("online already-online block: %v", err)
+	}
+	got, _ = os.ReadFile(filepath.Join(dir, "memory0", "state"))
+	if string(got) != "online\n" {
+		t.Errorf("memory0 should be left alone: got %q", got)
+	}
+}
+
+func TestParseUevent(t *testing.T) {
+	msg := []byte("add@/devices/system/memory/memory40\x00ACTION=add\x00DEVPATH=/devices/system/memory/memory40\x00SUBSYSTEM=memory\x00SEQNUM=1234\x00")
+	ev := parseUevent(msg)
+	if ev["ACTION"] != "add" || ev["SUBSYSTEM"] != "memory" {
+		t.Errorf("parseUevent: got %v", ev)
+	}
+	if ev["DEVPATH"] != "/devices/system/memory/memory40" {
+		t.Errorf("DEVPATH: got %q", ev["DEVPATH"])
+	}
+}
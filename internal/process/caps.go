@@ -0,0 +1,195 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/seccomp"
+)
+
+var capabilities = map[string]int{
+	"chown":              unix.CAP_CHOWN,
+	"dac_override":       unix.CAP_DAC_OVERRIDE,
+	"dac_read_search":    unix.CAP_DAC_READ_SEARCH,
+	"fowner":             unix.CAP_FOWNER,
+	"fsetid":             unix.CAP_FSETID,
+	"kill":               unix.CAP_KILL,
+	"setgid":             unix.CAP_SETGID,
+	"setuid":             unix.CAP_SETUID,
+	"setpcap":            unix.CAP_SETPCAP,
+	"linux_immutable":    unix.CAP_LINUX_IMMUTABLE,
+	"net_bind_service":   unix.CAP_NET_BIND_SERVICE,
+	"net_broadcast":      unix.CAP_NET_BROADCAST,
+	"net_admin":          unix.CAP_NET_ADMIN,
+	"net_raw":            unix.CAP_NET_RAW,
+	"ipc_lock":           unix.CAP_IPC_LOCK,
+	"ipc_owner":          unix.CAP_IPC_OWNER,
+	"sys_module":         unix.CAP_SYS_MODULE,
+	"sys_rawio":          unix.CAP_SYS_RAWIO,
+	"sys_chroot":         unix.CAP_SYS_CHROOT,
+	"sys_ptrace":         unix.CAP_SYS_PTRACE,
+	"sys_pacct":          unix.CAP_SYS_PACCT,
+	"sys_admin":          unix.CAP_SYS_ADMIN,
+	"sys_boot":           unix.CAP_SYS_BOOT,
+	"sys_nice":           unix.CAP_SYS_NICE,
+	"sys_resource":       unix.CAP_SYS_RESOURCE,
+	"sys_time":           unix.CAP_SYS_TIME,
+	"sys_tty_config":     unix.CAP_SYS_TTY_CONFIG,
+	"mknod":              unix.CAP_MKNOD,
+	"lease":              unix.CAP_LEASE,
+	"audit_write":        unix.CAP_AUDIT_WRITE,
+	"audit_control":      unix.CAP_AUDIT_CONTROL,
+	"setfcap":            unix.CAP_SETFCAP,
+	"mac_override":       unix.CAP_MAC_OVERRIDE,
+	"mac_admin":          unix.CAP_MAC_ADMIN,
+	"syslog":             unix.CAP_SYSLOG,
+	"wake_alarm":         unix.CAP_WAKE_ALARM,
+	"block_suspend":      unix.CAP_BLOCK_SUSPEND,
+	"audit_read":         unix.CAP_AUDIT_READ,
+	"perfmon":            unix.CAP_PERFMON,
+	"bpf":                unix.CAP_BPF,
+	"checkpoint_restore": unix.CAP_CHECKPOINT_RESTORE,
+}
+
+// Security is the privilege profile applied by the spawn helper.
+type Security struct {
+	LimitBounding bool              `json:"limit_bounding,omitempty"`
+	Bounding      []int             `json:"bounding,omitempty"` // kept when LimitBounding
+	Ambient       []int             `json:"ambient,omitempty"`
+	NoNewPrivs    bool              `json:"no_new_privs,omitempty"`
+	Seccomp       []unix.SockFilter `json:"seccomp,omitempty"`
+}
+
+// ParseSecurity converts a config security block. Capability names are
+// case-insensitive with an optional "CAP_" prefix. A nil Capabilities list
+// keeps the full bounding set; an empty one drops every capability. The
+// seccomp profile, if any, is loaded and compiled here.
+func ParseSecurity(sec *config.Security) (*Security, error) {
+	if sec == nil {
+		return nil, nil
+	}
+	out := &Security{NoNewPrivs: sec.NoNewPrivileges}
+
+	var err error
+	if sec.Capabilities != nil {
+		out.LimitBounding = true
+		if out.Bounding, err = parseCaps(sec.Capabilities); err != nil {
+			return nil, err
+		}
+	}
+	if out.Ambient, err = parseCaps(sec.AmbientCapabilities); err != nil {
+		return nil, err
+	}
+	if out.LimitBounding {
+		for _, c := range out.Ambient {
+			if !hasCap(out.Bounding, c) {
+				return nil, fmt.Errorf("ambient capability %s not in bounding set", capName(c))
+			}
+		}
+	}
+
+	if sec.Seccomp != nil {
+		profile, err := seccomp.Load(sec.Seccomp)
+		if err != nil {
+			return nil, err
+		}
+		if out.Seccomp, err = profile.Compile(out.hasCap); err != nil {
+			return nil, fmt.Errorf("compile seccomp profile: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// hasCap reports whether the named capability stays in the bounding set.
+func (s *Security) hasCap(name string) bool {
+	if !s.LimitBounding {
+		return true
+	}
+	c, ok := capabilities[strings.TrimPrefix(strings.ToLower(name), "cap_")]
+	return ok && hasCap(s.Bounding, c)
+}
+
+func parseCaps(names []string) ([]int, error) {
+	var out []int
+	for _, name := range names {
+		key := strings.TrimPrefix(strings.ToLower(name), "cap_")
+		c, ok := capabilities[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown capability %q", name)
+		}
+		if !hasCap(out, c) {
+			out = append(out, c)
+		}
+	}
+	sort.Ints(out)
+	return out, nil
+}
+
+func hasCap(caps []int, c int) bool {
+	for _, x := range caps {
+		if x == c {
+			return true
+		}
+	}
+	return false
+}
+
+func capName(c int) string {
+	for name, v := range capabilities {
+		if v == c {
+			return "CAP_" + strings.ToUpper(name)
+		}
+	}
+	return fmt.Sprintf("capability %d", c)
+}
+
+// dropBounding removes every capability not in keep from the bounding set.
+// Capabilities newer than the table above are dropped as well.
+func dropBounding(keep []int) error {
+	for c := 0; ; c++ {
+		if _, err := unix.PrctlRetInt(unix.PR_CAPBSET_READ, uintptr(c), 0, 0, 0); err != nil {
+			return nil // past CAP_LAST_CAP
+		}
+		if hasCap(keep, c) {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			return fmt.Errorf("drop %s from bounding set: %w", capName(c), err)
+		}
+	}
+}
+
+// raiseAmbient makes caps inheritable and raises them in the ambient set.
+// For non-root targets the permitted and effective sets are reduced to caps,
+// which must still be held after setuid (PR_SET_KEEPCAPS).
+func raiseAmbient(caps []int, root bool) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capget: %w", err)
+	}
+	var set [2]uint32
+	for _, c := range caps {
+		set[c/32] |= 1 << (c % 32)
+	}
+	for i := range data {
+		data[i].Inheritable = set[i]
+		if !root {
+			data[i].Permitted = set[i]
+			data[i].Effective = set[i]
+		}
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capset: %w", err)
+	}
+	for _, c := range caps {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(c), 0, 0); err != nil {
+			return fmt.Errorf("raise ambient %s: %w", capName(c), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+func TestParseSecurity(t *testing.T) {
+	sec, err := ParseSecurity(&config.Security{
+		Capabilities:        []string{"CAP_NET_BIND_SERVICE", "chown", "net_bind_service"},
+		AmbientCapabilities: []string{"cap_net_bind_service"},
+		NoNewPrivileges:     true,
+	})
+	if err != nil {
+		t.Fatalf("ParseSecurity: %v", err)
+	}
+	want := &Security{
+		LimitBounding: true,
+		Bounding:      []int{unix.CAP_CHOWN, unix.CAP_NET_BIND_SERVICE},
+		Ambient:       []int{unix.CAP_NET_BIND_SERVICE},
+		NoNewPrivs:    true,
+	}
+	if !reflect.DeepEqual(sec, want) {
+		t.Errorf("got %+v, want %+v", sec, want)
+	}
+}
+
+func TestParseSecurity_Nil(t *testing.T) {
+	sec, err := ParseSecurity(nil)
+	if err != nil || sec != nil {
+		t.Errorf("ParseSecurity(nil): got %+v, %v", sec, err)
+	}
+}
+
+func TestParseSecurity_EmptyBoundingDropsAll(t *testing.T) {
+	sec, err := ParseSecurity(&config.Security{Capabilities: []string{}})
+	if err != nil {
+		t.Fatalf("ParseSecurity: %v", err)
+	}
+	if !sec.LimitBounding || len(sec.Bounding) != 0 {
+		t.Errorf("got %+v, want empty limited bounding set", sec)
+	}
+}
+
+func TestParseSecurity_Errors(t *testing.T) {
+	tests := map[string]*config.Security{
+		"unknown":             {AmbientCapabilities: []string{"CAP_FLY"}},
+		"ambient not bounded": {Capabilities: []string{"chown"}, AmbientCapabilities: []string{"net_raw"}},
+	}
+	for name, sec := range tests {
+		if _, err := ParseSecurity(sec); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/seccomp"
+	"github.com/pigeon-as/pigeon-init/internal/user"
+)
+
+// Processes are spawned by re-executing init as a short-lived helper that
+// applies what SysProcAttr can't express (namespace setup, umask, rlimits,
+// scheduling attributes, capabilities, seccomp), drops privileges and execs
+// the target. The helper reads its childSpec from the inherited fd named
+// in childEnv: a spec with a seccomp profile can exceed the 128 KiB limit
+// on a single env string.
+
+const (
+	childEnv      = "_PIGEON_INIT_CHILD"
+	childExitCode = 127
+)
+
+type childSpec struct {
+	Path      string      `json:"path"`
+	Argv      []string    `json:"argv"`
+	Env       []string    `json:"env"`
+	Dir       string      `json:"dir,omitempty"`
+	CreateDir bool        `json:"create_dir,omitempty"`
+	Setuid    bool        `json:"setuid,omitempty"`
+	User      string      `json:"user,omitempty"` // resolved inside the namespaces
+	UID       uint32      `json:"uid,omitempty"`
+	GID       uint32      `json:"gid,omitempty"`
+	Groups    []int       `json:"groups,omitempty"`
+	Rlimits   []Rlimit    `json:"rlimits,omitempty"`
+	Security  *Security   `json:"security,omitempty"`
+	Sched     *Scheduling `json:"sched,omitempty"`
+	Umask     *int        `json:"umask,omitempty"`
+
+	Namespaces *config.Namespaces `json:"namespaces,omitempty"`
+	Filesystem *config.Filesystem `json:"filesystem,omitempty"`
+	Join       *Join              `json:"join,omitempty"`
+}
+
+// IsChild reports whether this process is the spawn helper. The helper may
+// itself be PID 1 of a new PID namespace.
+func IsChild() bool {
+	return os.Getenv(childEnv) != ""
+}
+
+// ChildMain runs the spawn helper. It never returns: it either execs the
+// target or exits with status 127. In a new PID namespace it stays behind
+// as the namespace's PID 1 (see reaper).
+func ChildMain() {
+	runtime.LockOSThread()
+
+	spec, err := readSpec()
+	if err != nil {
+		childFatal(fmt.Errorf("decode spec: %w", err))
+	}
+	childFatal(execChild(spec))
+}
+
+// attachSpec passes spec to the helper cmd runs in a memfd. The parent's
+// copy of the memfd is closed when it is garbage collected.
+func attachSpec(cmd *exec.Cmd, spec *childSpec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	fd, err := unix.MemfdCreate("pigeon-init-spec", unix.MFD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("create spec memfd: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), "spec")
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("write spec: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	cmd.Env = []string{childEnv + "=" + strconv.Itoa(2+len(cmd.ExtraFiles))}
+	return nil
+}
+
+func readSpec() (*childSpec, error) {
+	fd, err := strconv.Atoi(os.Getenv(childEnv))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", childEnv, err)
+	}
+	f := os.NewFile(uintptr(fd), "spec")
+	defer f.Close()
+	var spec childSpec
+	if err := json.NewDecoder(f).Decode(&spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+func execChild(spec *childSpec) error {
+	if spec.Join != nil {
+		if spec.Join.Namespaces.PID {
+			relay(spec)
+		}
+		if err := joinNamespaces(spec.Join); err != nil {
+			return err
+		}
+	}
+	if err := setupNamespaces(spec); err != nil {
+		return err
+	}
+	if spec.Namespaces != nil && spec.Namespaces.PID {
+		reaper(spec)
+	}
+	if spec.User != "" {
+		identity, err := user.Resolve(spec.User, nil)
+		if err != nil {
+			return err
+		}
+		spec.setIdentity(identity)
+	}
+	if spec.CreateDir {
+		if err := createDir(spec.Dir, int(spec.UID), int(spec.GID)); err != nil {
+			return fmt.Errorf("create working directory: %w", err)
+		}
+	}
+
+	for _, rl := range spec.Rlimits {
+		if err := unix.Setrlimit(rl.Resource, &unix.Rlimit{Cur: rl.Soft, Max: rl.Hard}); err != nil {
+			return fmt.Errorf("setrlimit %s: %w", rl.Name, err)
+		}
+	}
+
+	if spec.Umask != nil {
+		syscall.Umask(*spec.Umask)
+	}
+	if spec.Sched != nil {
+		if err := spec.Sched.apply(); err != nil {
+			return err
+		}
+	} else {
+		// Don't leave init's protective oom_score_adj on the target.
+		_ = SetOOMScoreAdj(0)
+	}
+
+	sec := spec.Security
+	if sec == nil {
+		sec = &Security{}
+	}
+	if sec.LimitBounding {
+		if err := dropBounding(sec.Bounding); err != nil {
+			return err
+		}
+	}
+	// Without no_new_privs the filter needs CAP_SYS_ADMIN, so it goes in
+	// before setuid and must allow the remaining setup calls (as in runc).
+	earlySeccomp := len(sec.Seccomp) > 0 && !sec.NoNewPrivs
+	if earlySeccomp {
+		if err := seccomp.Install(sec.Seccomp); err != nil {
+			return err
+		}
+	}
+	keepCaps := spec.Setuid && spec.UID != 0 && len(sec.Ambient) > 0
+	if keepCaps {
+		if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set keepcaps: %w", err)
+		}
+	}
+
+	if spec.Setuid {
+		if err := syscall.Setgroups(spec.Groups); err != nil {
+			return fmt.Errorf("setgroups: %w", err)
+		}
+		if err := syscall.Setgid(int(spec.GID)); err != nil {
+			return fmt.Errorf("setgid %d: %w", spec.GID, err)
+		}
+		if err := syscall.Setuid(int(spec.UID)); err != nil {
+			return fmt.Errorf("setuid %d: %w", spec.UID, err)
+		}
+	}
+
+	if len(sec.Ambient) > 0 {
+		if err := raiseAmbient(sec.Ambient, !keepCaps); err != nil {
+			return err
+		}
+	}
+	if sec.NoNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set no_new_privs: %w", err)
+		}
+	}
+
+	if spec.Dir != "" {
+		if err := os.Chdir(spec.Dir); err != nil {
+			return err
+		}
+	}
+
+	// Resolved here so the lookup sees the process's own mounts.
+	path, err := LookPath(spec.Argv[0], spec.Env)
+	if err != nil {
+		return err
+	}
+
+	if len(sec.Seccomp) > 0 && !earlySeccomp {
+		if err := seccomp.Install(sec.Seccomp); err != nil {
+			return err
+		}
+	}
+
+	if err := syscall.Exec(path, spec.Argv, spec.Env); err != nil {
+		return fmt.Errorf("exec %s: %w", path, err)
+	}
+	return nil
+}
+
+func (spec *childSpec) setIdentity(id *user.Identity) {
+	spec.Setuid = true
+	spec.UID, spec.GID = id.UID, id.GID
+	spec.Groups = spec.Groups[:0]
+	for _, g := range id.Groups {
+		spec.Groups = append(spec.Groups, int(g))
+	}
+}
+
+func childFatal(err error) {
+	fmt.Fprintf(os.Stderr, "pigeon-init: %v\n", err)
+	os.Exit(childExitCode)
+}
@@ -0,0 +1,295 @@
+//go:build linux
+
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/user"
+)
+
+// Spec.Command re-executes /proc/self/exe, which is the test binary here.
+func TestMain(m *testing.M) {
+	if IsChild() {
+		ChildMain()
+	}
+	os.Exit(m.Run())
+}
+
+func TestCommand_ExecsTarget(t *testing.T) {
+	dir := t.TempDir()
+	spec := Spec{Env: []string{"FOO=bar"}, WorkDir: dir}
+
+	out, err := spec.Command(context.Background(), []string{"sh", "-c", `echo "$FOO $(pwd)"`}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "bar "+dir {
+		t.Errorf("output: got %q, want %q", got, "bar "+dir)
+	}
+}
+
+func TestCommand_AppliesRlimits(t *testing.T) {
+	spec := Spec{Rlimits: []Rlimit{{Name: "nofile", Resource: unix.RLIMIT_NOFILE, Soft: 512, Hard: 512}}}
+
+	out, err := spec.Command(context.Background(), []string{"sh", "-c", "ulimit -n"}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "512" {
+		t.Errorf("ulimit -n: got %q, want 512", got)
+	}
+}
+
+func TestCommand_NotFound(t *testing.T) {
+	out, err := Spec{}.Command(context.Background(), []string{"pigeon-nonexistent-binary"}).CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != childExitCode {
+		t.Fatalf("run: got %v, want exit %d", err, childExitCode)
+	}
+	if !strings.Contains(string(out), "not found in PATH (searched ") {
+		t.Errorf("output: got %q, want the searched directories", out)
+	}
+}
+
+// A spec larger than MAX_ARG_STRLEN (128 KiB) must still reach the helper.
+func TestCommand_LargeSpec(t *testing.T) {
+	env := []string{"PATH=/usr/bin:/bin"}
+	for i := 0; i < 2000; i++ {
+		env = append(env, fmt.Sprintf("VAR%d=%s", i, strings.Repeat("x", 100)))
+	}
+	out, err := Spec{Env: env}.Command(context.Background(), []string{"sh", "-c", `echo "$VAR1999"`}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != strings.Repeat("x", 100) {
+		t.Errorf("VAR1999: got %q", got)
+	}
+}
+
+func TestCommand_ChdirFailureExits127(t *testing.T) {
+	spec := Spec{WorkDir: "/nonexistent"}
+	err := spec.Command(context.Background(), []string{"true"}).Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != childExitCode {
+		t.Errorf("chdir failure: got %v, want exit status %d", err, childExitCode)
+	}
+}
+
+func TestCommand_CreatesWorkDir(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	dir := filepath.Join(t.TempDir(), "app", "data")
+	spec := Spec{WorkDir: dir, CreateWorkDir: true}
+
+	out, err := spec.Command(context.Background(), []string{"pwd"}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != dir {
+		t.Errorf("pwd: got %q, want %q", got, dir)
+	}
+}
+
+func TestCommand_AppliesSecurity(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	spec := Spec{
+		Identity: &user.Identity{UID: 65534, GID: 65534},
+		Security: &Security{
+			LimitBounding: true,
+			Bounding:      []int{unix.CAP_NET_BIND_SERVICE},
+			Ambient:       []int{unix.CAP_NET_BIND_SERVICE},
+			NoNewPrivs:    true,
+		},
+	}
+
+	out, err := spec.Command(context.Background(), []string{"cat", "/proc/self/status"}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := map[string]string{
+		"CapBnd":     "0000000000000400",
+		"CapAmb":     "0000000000000400",
+		"CapEff":     "0000000000000400",
+		"NoNewPrivs": "1",
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, val, _ := strings.Cut(line, ":")
+		if w, ok := want[key]; ok {
+			if got := strings.TrimSpace(val); got != w {
+				t.Errorf("%s: got %s, want %s", key, got, w)
+			}
+			delete(want, key)
+		}
+	}
+	for key := range want {
+		t.Errorf("%s missing from /proc/self/status", key)
+	}
+}
+
+func TestCommand_AppliesSeccomp(t *testing.T) {
+	// Without no_new_privs the filter is installed before dropping
+	// privileges, which needs root.
+	modes := []bool{true}
+	if os.Getuid() == 0 {
+		modes = append(modes, false)
+	}
+	for _, nnp := range modes {
+		sec, err := ParseSecurity(&config.Security{
+			NoNewPrivileges: nnp,
+			Seccomp: &config.Seccomp{Profile: json.RawMessage(`{
+				"defaultAction": "SCMP_ACT_ALLOW",
+				"syscalls": [{"names": ["mkdir", "mkdirat"], "action": "SCMP_ACT_ERRNO", "errnoRet": 13}]
+			}`)},
+		})
+		if err != nil {
+			t.Fatalf("ParseSecurity: %v", err)
+		}
+		dir := t.TempDir()
+		spec := Spec{Security: sec}
+
+		out, err := spec.Command(context.Background(), []string{"mkdir", dir + "/x"}).CombinedOutput()
+		if err == nil {
+			t.Fatalf("no_new_privs=%v: mkdir succeeded under seccomp filter", nnp)
+		}
+		if !strings.Contains(string(out), "Permission denied") {
+			t.Errorf("no_new_privs=%v: mkdir output: got %q, want EACCES", nnp, out)
+		}
+	}
+}
+
+func TestCommand_NewNamespaces(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	spec := Spec{Namespaces: &config.Namespaces{PID: true, UTS: true}}
+
+	out, err := spec.Command(context.Background(), []string{"sh", "-c", `echo $PPID; readlink /proc/self/ns/uts`}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	self, _ := os.Readlink("/proc/self/ns/uts")
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 || fields[0] != "1" || fields[1] == self {
+		t.Errorf("output: got %q, want a child of pid 1 in a new UTS namespace (not %s)", out, self)
+	}
+}
+
+func TestCommand_ReaperForwardsSignals(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	spec := Spec{Namespaces: &config.Namespaces{PID: true}}
+	cmd := spec.Command(context.Background(), []string{"sh", "-c", `trap 'exit 7' TERM; echo ready; sleep 10 & wait`})
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := stdout.Read(make([]byte, 16)); err != nil {
+		t.Fatalf("wait for ready: %v", err)
+	}
+
+	// Only the reaper is signalled; it relays to the workload's group.
+	if err := cmd.Process.Signal(unix.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); cmd.ProcessState.ExitCode() != 7 {
+		t.Errorf("exit: got %v, want code 7 from the trap", err)
+	}
+}
+
+func TestCommand_JoinNamespaces(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	ns := &config.Namespaces{PID: true, UTS: true}
+	workload := Spec{Namespaces: ns}.Command(context.Background(), []string{"sleep", "10"})
+	if err := workload.Start(); err != nil {
+		t.Fatalf("start workload: %v", err)
+	}
+	defer func() {
+		_ = workload.Process.Kill()
+		_ = workload.Wait()
+	}()
+
+	// Namespaces are created at clone time, so they can be read right away.
+	want := make(map[string]string)
+	for _, name := range []string{"pid", "uts", "mnt"} {
+		link, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/%s", workload.Process.Pid, name))
+		if err != nil {
+			t.Fatalf("read %s namespace: %v", name, err)
+		}
+		want[name] = link
+	}
+
+	spec := Spec{Join: &Join{PID: workload.Process.Pid, Namespaces: *normalizeNamespaces(ns)}}
+	out, err := spec.Command(context.Background(), []string{"sh", "-c", `readlink /proc/self/ns/pid /proc/self/ns/uts /proc/self/ns/mnt`}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	got := strings.Fields(string(out))
+	if len(got) != 3 || got[0] != want["pid"] || got[1] != want["uts"] || got[2] != want["mnt"] {
+		t.Errorf("namespaces: got %q, want %v", got, want)
+	}
+}
+
+func TestCommand_AppliesScheduling(t *testing.T) {
+	spec := Spec{Sched: &Scheduling{OOMScoreAdj: 300, Nice: intPtr(7), CPUs: []int{0}}}
+
+	out, err := spec.Command(context.Background(), []string{"sh", "-c",
+		`cat /proc/self/oom_score_adj; cut -d' ' -f19 /proc/self/stat; grep Cpus_allowed_list /proc/self/status | cut -f2`}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.Fields(string(out)); !reflect.DeepEqual(got, []string{"300", "7", "0"}) {
+		t.Errorf("oom_score_adj, nice, cpus: got %q, want [300 7 0]", got)
+	}
+}
+
+func TestCommand_AppliesUmask(t *testing.T) {
+	umask := 0027
+	spec := Spec{Umask: &umask}
+
+	out, err := spec.Command(context.Background(), []string{"sh", "-c", "umask"}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "0027" {
+		t.Errorf("umask: got %q, want 0027", got)
+	}
+}
+
+func TestCommand_ResolvesAgainstSpecEnv(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "pigeon-test-tool")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho found\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	spec := Spec{Env: []string{"PATH=" + dir + ":/usr/bin:/bin"}}
+
+	out, err := spec.Command(context.Background(), []string{"pigeon-test-tool"}).Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "found" {
+		t.Errorf("output: got %q, want found", got)
+	}
+}
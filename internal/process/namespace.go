@@ -0,0 +1,215 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/boot"
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// Join enters the namespaces of a running process.
+type Join struct {
+	PID        int               `json:"pid"`
+	Namespaces config.Namespaces `json:"namespaces"`
+}
+
+// normalizeNamespaces returns a copy of ns with Mount set when PID or IPC
+// is, since /proc and /dev/mqueue have to be remounted for them.
+func normalizeNamespaces(ns *config.Namespaces) *config.Namespaces {
+	if ns == nil {
+		return nil
+	}
+	n := *ns
+	n.Mount = ns.NewMount()
+	return &n
+}
+
+func cloneFlags(ns *config.Namespaces) uintptr {
+	var flags uintptr
+	if ns.Mount {
+		flags |= unix.CLONE_NEWNS
+	}
+	if ns.PID {
+		flags |= unix.CLONE_NEWPID
+	}
+	if ns.IPC {
+		flags |= unix.CLONE_NEWIPC
+	}
+	if ns.UTS {
+		flags |= unix.CLONE_NEWUTS
+	}
+	return flags
+}
+
+// setupNamespaces prepares namespaces the helper was cloned into: mounts
+// are made private, /proc and /dev/mqueue remounted for the new PID and IPC
+// namespaces, and the filesystem hardening applied inside.
+func setupNamespaces(spec *childSpec) error {
+	ns := spec.Namespaces
+	if ns == nil || !ns.Mount {
+		return nil
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	if ns.PID {
+		if err := unix.Mount("proc", "/proc", "proc", unix.MS_NODEV|unix.MS_NOEXEC|unix.MS_NOSUID, ""); err != nil {
+			return fmt.Errorf("mount /proc: %w", err)
+		}
+	}
+	if ns.IPC {
+		if err := unix.Mount("mqueue", "/dev/mqueue", "mqueue", unix.MS_NODEV|unix.MS_NOEXEC|unix.MS_NOSUID, ""); err != nil {
+			return fmt.Errorf("mount /dev/mqueue: %w", err)
+		}
+	}
+	if err := boot.HardenRootfs(spec.Filesystem, spec.UID, spec.GID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// joinNamespaces enters the IPC, UTS and mount namespaces of j.PID on the
+// calling thread. The PID namespace is handled by relay.
+func joinNamespaces(j *Join) error {
+	nss := []struct {
+		set  bool
+		name string
+		flag int
+	}{
+		{j.Namespaces.IPC, "ipc", unix.CLONE_NEWIPC},
+		{j.Namespaces.UTS, "uts", unix.CLONE_NEWUTS},
+		{j.Namespaces.Mount, "mnt", unix.CLONE_NEWNS},
+	}
+	for _, ns := range nss {
+		if !ns.set {
+			continue
+		}
+		if ns.flag == unix.CLONE_NEWNS {
+			// Go threads share filesystem attributes, which setns(CLONE_NEWNS)
+			// refuses. Give this thread its own before switching.
+			if err := unix.Unshare(unix.CLONE_FS); err != nil {
+				return fmt.Errorf("unshare fs: %w", err)
+			}
+		}
+		if err := setns(j.PID, ns.name, ns.flag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setns(pid int, name string, flag int) error {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/ns/%s", pid, name))
+	if err != nil {
+		return fmt.Errorf("open %s namespace: %w", name, err)
+	}
+	defer f.Close()
+	if err := unix.Setns(int(f.Fd()), flag); err != nil {
+		return fmt.Errorf("setns %s: %w", name, err)
+	}
+	return nil
+}
+
+// relay enters the PID namespace of spec.Join, which only applies to
+// children, and runs the rest of spec in a new helper forked into it. It
+// forwards signals and exits with the helper's status.
+func relay(spec *childSpec) {
+	if err := setns(spec.Join.PID, "pid", unix.CLONE_NEWPID); err != nil {
+		childFatal(err)
+	}
+	next := *spec
+	join := *spec.Join
+	join.Namespaces.PID = false
+	next.Join = &join
+
+	// No Pdeathsig: Go's check for an already dead parent compares
+	// getppid(), which is 0 across the PID namespace boundary. The session's
+	// process group is killed as a whole instead.
+
+	// Signals are caught rather than ignored so the disposition isn't
+	// inherited. Terminal signals already reach the whole process group.
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2,
+		syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP)
+	cmd := startHelper(&next, nil)
+	go func() {
+		for sig := range sigs {
+			switch sig {
+			case syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP:
+			default:
+				_ = cmd.Process.Signal(sig)
+			}
+		}
+	}()
+	_ = cmd.Wait()
+	exitWith(cmd.ProcessState.Sys().(syscall.WaitStatus))
+}
+
+// reaper stays behind as PID 1 of the helper's new PID namespace and runs
+// the rest of spec in a new helper in its own process group. It forwards
+// every signal it gets to that group, reaps orphans and exits with the
+// helper's status, which takes the rest of the namespace down with it.
+func reaper(spec *childSpec) {
+	next := *spec
+	next.Namespaces, next.Filesystem = nil, nil
+
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs)
+	cmd := startHelper(&next, &syscall.SysProcAttr{Setpgid: true})
+	pid := cmd.Process.Pid
+	go func() {
+		for sig := range sigs {
+			switch sig {
+			case syscall.SIGCHLD, syscall.SIGURG: // SIGURG preempts goroutines
+			default:
+				_ = unix.Kill(-pid, sig.(syscall.Signal))
+			}
+		}
+	}()
+	for {
+		var ws unix.WaitStatus
+		got, err := unix.Wait4(-1, &ws, 0, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			childFatal(fmt.Errorf("wait: %w", err))
+		}
+		if got == pid {
+			exitWith(syscall.WaitStatus(ws))
+		}
+	}
+}
+
+// startHelper starts a new spawn helper for spec on the same stdio.
+func startHelper(spec *childSpec, attr *syscall.SysProcAttr) *exec.Cmd {
+	cmd := exec.Command("/proc/self/exe")
+	cmd.Args = []string{spec.Argv[0]}
+	if err := attachSpec(cmd, spec); err != nil {
+		childFatal(err)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = attr
+	if err := cmd.Start(); err != nil {
+		childFatal(err)
+	}
+	return cmd
+}
+
+// exitWith exits with the status of a waited-for helper, re-raising the
+// signal that killed it. PID 1 of a namespace can't be killed by its own
+// signal and falls back to 128+signal.
+func exitWith(ws syscall.WaitStatus) {
+	if ws.Signaled() {
+		signal.Reset(ws.Signal())
+		_ = unix.Kill(os.Getpid(), ws.Signal())
+		os.Exit(128 + int(ws.Signal()))
+	}
+	os.Exit(ws.ExitStatus())
+}
@@ -0,0 +1,75 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPath is searched when the environment has no PATH (Docker's
+// default), and is init's own PATH.
+const DefaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// NotFoundError reports a command missing from every searched directory.
+type NotFoundError struct {
+	Name string
+	Dirs []string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%q: executable file not found in PATH (searched %s)", e.Name, strings.Join(e.Dirs, ", "))
+}
+
+// LookPath resolves file against the PATH in env, like exec.LookPath does
+// against the current process's. Names containing a slash are used as is;
+// absolute ones must be executable, relative ones are left to the exec in
+// the working directory. Relative PATH entries are skipped for the same
+// reason exec.LookPath rejects them.
+func LookPath(file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		if filepath.IsAbs(file) {
+			if err := executable(file); err != nil {
+				return "", fmt.Errorf("%q: %w", file, err)
+			}
+		}
+		return file, nil
+	}
+
+	path := DefaultPath
+	for i := len(env) - 1; i >= 0; i-- {
+		if v, ok := strings.CutPrefix(env[i], "PATH="); ok {
+			path = v
+			break
+		}
+	}
+
+	var dirs []string
+	for _, dir := range filepath.SplitList(path) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+		if p := filepath.Join(dir, file); executable(p) == nil {
+			return p, nil
+		}
+	}
+	return "", &NotFoundError{Name: file, Dirs: dirs}
+}
+
+// executable reports whether path is a regular file with an execute bit.
+func executable(path string) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if st.IsDir() {
+		return errors.New("is a directory")
+	}
+	if st.Mode()&0111 == 0 {
+		return fs.ErrPermission
+	}
+	return nil
+}
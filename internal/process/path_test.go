@@ -0,0 +1,64 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeExecutable(t *testing.T, path string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookPath_UsesEnvPath(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeExecutable(t, filepath.Join(a, "tool"), 0644) // not executable
+	writeExecutable(t, filepath.Join(b, "tool"), 0755)
+
+	got, err := LookPath("tool", []string{"HOME=/", "PATH=" + a + ":relative:" + b})
+	if err != nil {
+		t.Fatalf("LookPath: %v", err)
+	}
+	if want := filepath.Join(b, "tool"); got != want {
+		t.Errorf("LookPath: got %q, want %q", got, want)
+	}
+}
+
+func TestLookPath_NotFoundListsDirs(t *testing.T) {
+	a := t.TempDir()
+	_, err := LookPath("pigeon-nonexistent-binary", []string{"PATH=" + a + "::/nonexistent"})
+
+	var nf *NotFoundError
+	if !errors.As(err, &nf) {
+		t.Fatalf("LookPath: got %v, want NotFoundError", err)
+	}
+	if want := []string{a, "/nonexistent"}; !reflect.DeepEqual(nf.Dirs, want) {
+		t.Errorf("searched dirs: got %q, want %q", nf.Dirs, want)
+	}
+}
+
+func TestLookPath_DefaultPath(t *testing.T) {
+	_, err := LookPath("pigeon-nonexistent-binary", nil)
+	var nf *NotFoundError
+	if !errors.As(err, &nf) || len(nf.Dirs) != 6 {
+		t.Errorf("LookPath without PATH: got %v, want search of the default PATH", err)
+	}
+	if _, err := LookPath("sh", nil); err != nil {
+		t.Errorf("LookPath(sh) without PATH: %v", err)
+	}
+}
+
+func TestLookPath_Slash(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LookPath(dir, nil); err == nil {
+		t.Error("LookPath(directory): expected error")
+	}
+	if got, err := LookPath("./bin/app", nil); err != nil || got != "./bin/app" {
+		t.Errorf("LookPath(relative): got %q, %v", got, err)
+	}
+}
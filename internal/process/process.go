@@ -2,12 +2,15 @@ package process
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -15,86 +18,231 @@ import (
 
 	"golang.org/x/sys/unix"
 
+	"github.com/pigeon-as/pigeon-init/internal/cgroup"
+	"github.com/pigeon-as/pigeon-init/internal/config"
 	"github.com/pigeon-as/pigeon-init/internal/user"
 )
 
 type Result struct {
 	ExitCode  int  `json:"code"`
 	OOMKilled bool `json:"oom_killed"`
+
+	RestartCount   int    `json:"restart_count"`
+	LastExitReason string `json:"last_exit_reason,omitempty"`
 }
 
 type Supervisor struct {
-	cmd *exec.Cmd
-	pid int
-	pr  *os.File
+	cmd      *exec.Cmd
+	argv     []string
+	spec     Spec
+	uid, gid int
+	ns       *config.Namespaces
+	pid      int // 0 while waiting to restart
+	pr       *os.File
+	started  time.Time
 
 	result   Result
 	resultCh chan struct{}
+	finished bool
 	mu       sync.Mutex
+	statusMu sync.Mutex // guards result for Restarts, which mustn't wait on mu
 
 	SignalCh chan os.Signal
+	// StopSignal replaces SIGTERM, from the host or SignalCh, when set
+	// (image StopSignal).
+	StopSignal syscall.Signal
+	// Restart is the workload's restart policy; the zero value never
+	// restarts. Must be set before Start.
+	Restart RestartPolicy
+
+	restart      restarter
+	restartTimer *time.Timer
 
 	execMu    sync.Mutex
 	execWaits map[int]chan<- unix.WaitStatus
 
+	sidecars []*sidecar
+	stopping bool // no more sidecar restarts
+
 	logger *slog.Logger
 }
 
-func New(argv []string, env []string, workDir string, identity *user.Identity, logger *slog.Logger) (*Supervisor, error) {
+// Spec describes the environment a process is spawned into.
+type Spec struct {
+	Env      []string
+	WorkDir  string
+	Identity *user.Identity // nil runs as root
+	Cgroup   *cgroup.Group  // nil stays in init's cgroup
+	Rlimits  []Rlimit
+	Security *Security   // nil keeps init's privileges
+	Sched    *Scheduling // nil resets oom_score_adj to 0
+	Umask    *int        // nil inherits init's
+
+	// CreateWorkDir makes the helper create a missing WorkDir owned by the
+	// process's user, once its namespaces and filesystem are set up.
+	CreateWorkDir bool
+
+	Namespaces *config.Namespaces // new namespaces for the process
+	Filesystem *config.Filesystem // hardening applied in a new mount namespace
+	Join       *Join              // namespaces of a running process to enter
+	// User ("user[:group]") is used when Identity is nil. The helper resolves
+	// it after entering Join's namespaces, against the workload's users.
+	User string
+}
+
+// Command builds an unstarted command for argv according to the spec. The
+// command runs the spawn helper (see ChildMain), which execs argv[0]
+// resolved against the PATH in Env once the process's namespaces and
+// filesystem are set up. A missing command makes the helper exit 127.
+func (sp Spec) Command(ctx context.Context, argv []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{argv[0]}
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+
+	env := sp.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	child := childSpec{
+		Argv:       argv,
+		Env:        env,
+		Dir:        sp.WorkDir,
+		CreateDir:  sp.CreateWorkDir && sp.WorkDir != "",
+		Rlimits:    sp.Rlimits,
+		Security:   sp.Security,
+		Sched:      sp.Sched,
+		Umask:      sp.Umask,
+		Namespaces: normalizeNamespaces(sp.Namespaces),
+		Join:       sp.Join,
+	}
+	if child.Namespaces != nil {
+		cmd.SysProcAttr.Cloneflags = cloneFlags(child.Namespaces)
+		if child.Namespaces.Mount {
+			child.Filesystem = sp.Filesystem
+		}
+	}
+	if sp.Identity != nil {
+		child.setIdentity(sp.Identity)
+	} else if sp.User != "" {
+		child.User = sp.User
+	}
+	if err := attachSpec(cmd, &child); err != nil {
+		cmd.Err = err
+		return cmd
+	}
+
+	if sp.Cgroup != nil {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = sp.Cgroup.FD()
+	}
+	return cmd
+}
+
+func New(argv []string, spec Spec, logger *slog.Logger) (*Supervisor, error) {
 	if len(argv) == 0 {
 		return nil, fmt.Errorf("empty argv")
 	}
+	var uid, gid int
+	if spec.Identity != nil {
+		uid, gid = int(spec.Identity.UID), int(spec.Identity.GID)
+	}
+	s := &Supervisor{
+		argv:     argv,
+		spec:     spec,
+		uid:      uid,
+		gid:      gid,
+		ns:       normalizeNamespaces(spec.Namespaces),
+		resultCh: make(chan struct{}),
+		SignalCh: make(chan os.Signal, 16),
+		logger:   logger,
+	}
+	if err := s.prepare(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
 
-	cmd := exec.Command(argv[0], argv[1:]...)
-	cmd.Env = env
-	cmd.Dir = workDir
-
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{
-			Uid: identity.UID,
-			Gid: identity.GID,
-		},
-		Setsid: true,
+// prepare builds the workload command and its output pipe. A command can
+// only be started once, so each restart prepares a new one.
+func (s *Supervisor) prepare() error {
+	cmd := s.spec.Command(context.Background(), s.argv)
+	if cmd.Err != nil {
+		return cmd.Err
 	}
+	cmd.SysProcAttr.Setsid = true
 
 	pr, pw, err := os.Pipe()
 	if err != nil {
-		return nil, fmt.Errorf("create pipe: %w", err)
+		return fmt.Errorf("create pipe: %w", err)
 	}
-
-	if err := pr.Chown(int(identity.UID), int(identity.GID)); err != nil {
+	if err := pr.Chown(s.uid, s.gid); err != nil {
 		pr.Close()
 		pw.Close()
-		return nil, fmt.Errorf("chown pipe reader: %w", err)
+		return fmt.Errorf("chown pipe reader: %w", err)
 	}
-	if err := pw.Chown(int(identity.UID), int(identity.GID)); err != nil {
+	if err := pw.Chown(s.uid, s.gid); err != nil {
 		pr.Close()
 		pw.Close()
-		return nil, fmt.Errorf("chown pipe writer: %w", err)
+		return fmt.Errorf("chown pipe writer: %w", err)
 	}
 
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = pw
 	cmd.Stderr = pw
+	s.cmd = cmd
+	s.pr = pr
+	return nil
+}
 
-	return &Supervisor{
-		cmd:      cmd,
-		pr:       pr,
-		resultCh: make(chan struct{}),
-		SignalCh: make(chan os.Signal, 16),
-		logger:   logger,
-	}, nil
+// createDir creates path and any missing parents, owned by uid:gid.
+// Existing directories are left alone.
+func createDir(path string, uid, gid int) error {
+	var missing []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		missing = append(missing, p)
+		if p == "/" || p == "." {
+			break
+		}
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0755); err != nil {
+			return err
+		}
+		if err := os.Chown(missing[i], uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *Supervisor) Start() error {
-	if err := s.cmd.Start(); err != nil {
-		s.pr.Close()
-		if w, ok := s.cmd.Stdout.(*os.File); ok {
-			w.Close()
-		}
+	s.restart = restarter{policy: s.Restart}
+	if err := s.startSidecars(false); err != nil {
+		s.closePipe()
+		return err
+	}
+	s.mu.Lock()
+	err := s.spawn()
+	s.mu.Unlock()
+	if err != nil {
 		return fmt.Errorf("start workload: %w", err)
 	}
+	return s.startSidecars(true)
+}
+
+// spawn starts the prepared command. Must be called while holding s.mu.
+func (s *Supervisor) spawn() error {
+	if err := s.cmd.Start(); err != nil {
+		s.closePipe()
+		return err
+	}
 	s.pid = s.cmd.Process.Pid
+	s.started = time.Now()
 
 	// Close pipe write end in our process.
 	if w, ok := s.cmd.Stdout.(*os.File); ok {
@@ -102,12 +250,78 @@ func (s *Supervisor) Start() error {
 	}
 
 	// Copy pipe output to init stdout.
-	go func() {
-		_, _ = io.Copy(os.Stdout, s.pr)
-		s.pr.Close()
-	}()
+	go func(pr *os.File) {
+		_, _ = io.Copy(os.Stdout, pr)
+		pr.Close()
+	}(s.pr)
+
+	s.logger.Info("workload started", "pid", s.pid, "argv", s.argv)
+	return nil
+}
+
+func (s *Supervisor) closePipe() {
+	s.pr.Close()
+	if w, ok := s.cmd.Stdout.(*os.File); ok {
+		w.Close()
+	}
+}
+
+// restartWorkload runs after the restart backoff. A failed restart ends
+// the supervisor with the previous result.
+func (s *Supervisor) restartWorkload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return
+	}
+	err := s.prepare()
+	if err == nil {
+		err = s.spawn()
+	}
+	if err != nil {
+		s.logger.Error("restart workload failed", "err", err)
+		s.finish()
+	}
+}
 
-	s.logger.Info("workload started", "pid", s.pid, "argv", s.cmd.Args)
+// killLeftovers kills what the exited workload left running, so a restart
+// doesn't race its own orphans: the whole workload cgroup when there is
+// one, otherwise the process group. Must be called while holding s.mu.
+func (s *Supervisor) killLeftovers(pid int) {
+	if s.spec.Cgroup != nil {
+		err := s.spec.Cgroup.Kill()
+		if err == nil {
+			return
+		}
+		s.logger.Debug("kill workload cgroup failed, killing process group", "err", err)
+	}
+	_ = unix.Kill(-pid, unix.SIGKILL)
+}
+
+// finish publishes the result. Must be called while holding s.mu.
+func (s *Supervisor) finish() {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	s.stopping = true
+	if s.restartTimer != nil {
+		s.restartTimer.Stop()
+	}
+	close(s.resultCh)
+}
+
+func (s *Supervisor) startSidecars(afterMain bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sc := range s.sidecars {
+		if sc.AfterMain != afterMain {
+			continue
+		}
+		if err := s.startSidecar(sc); err != nil {
+			return fmt.Errorf("start sidecar %s: %w", sc.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -127,6 +341,9 @@ func (s *Supervisor) Run() Result {
 				return s.result
 			}
 
+		case <-s.resultCh:
+			return s.result
+
 		case sig := <-s.SignalCh:
 			s.forwardSignal(sig)
 
@@ -144,6 +361,25 @@ func (s *Supervisor) GetResult() Result {
 	return s.result
 }
 
+// Join returns how to enter the workload's namespaces, or nil if it runs in
+// init's.
+func (s *Supervisor) Join() (*Join, error) {
+	if s.ns == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.resultCh:
+		return nil, fmt.Errorf("workload not running")
+	default:
+	}
+	if s.pid == 0 {
+		return nil, fmt.Errorf("workload not started")
+	}
+	return &Join{PID: s.pid, Namespaces: *s.ns}, nil
+}
+
 func (s *Supervisor) Lock() {
 	s.mu.Lock()
 }
@@ -189,17 +425,35 @@ func (s *Supervisor) reap() bool {
 		}
 
 		if pid == s.pid {
-			if ws.Exited() {
-				s.result.ExitCode = ws.ExitStatus()
-			} else if ws.Signaled() {
-				s.result.ExitCode = 128 + int(ws.Signal())
-			}
-			s.result.OOMKilled = checkOOM(s.pid)
+			oom := checkOOM(s.pid)
+			s.statusMu.Lock()
+			s.result.ExitCode = exitCode(ws)
+			s.result.OOMKilled = oom
+			s.result.LastExitReason = exitReason(ws, oom)
+			s.statusMu.Unlock()
 			s.logger.Info("workload exited", "pid", pid, "exit_code", s.result.ExitCode, "oom", s.result.OOMKilled)
-			close(s.resultCh)
+			s.pid = 0
+
+			if !s.stopping {
+				if delay, ok := s.restart.next(s.result.ExitCode, time.Since(s.started)); ok {
+					s.killLeftovers(pid)
+					s.statusMu.Lock()
+					s.result.RestartCount = s.restart.count
+					s.statusMu.Unlock()
+					s.logger.Info("restarting workload", "in", delay, "restarts", s.restart.count)
+					s.restartTimer = time.AfterFunc(delay, s.restartWorkload)
+					continue
+				}
+			}
+			s.finish()
 			return true
 		}
 
+		if sc := s.sidecarByPID(pid); sc != nil {
+			s.sidecarExited(sc, ws)
+			continue
+		}
+
 		// Check exec session children.
 		s.execMu.Lock()
 		if ch, ok := s.execWaits[pid]; ok {
@@ -215,14 +469,79 @@ func (s *Supervisor) reap() bool {
 	}
 }
 
+// forwardSignal sends sig to the workload's process group, SIGTERM
+// becoming StopSignal. A stop signal disables restarts; while waiting to
+// restart it ends the supervisor.
 func (s *Supervisor) forwardSignal(sig os.Signal) {
 	sysSignal, ok := sig.(syscall.Signal)
 	if !ok {
 		return
 	}
+	if sysSignal == syscall.SIGTERM && s.StopSignal != 0 {
+		sysSignal = s.StopSignal
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stop := s.isStopSignal(sysSignal)
+	if stop {
+		s.stopping = true
+	}
+	if s.pid == 0 {
+		if stop {
+			s.logger.Info("restart cancelled", "signal", sysSignal)
+			s.finish()
+		}
+		return
+	}
 	if err := unix.Kill(-s.pid, sysSignal); err != nil {
-		s.logger.Warn("signal forward failed", "signal", sig, "pid", s.pid, "err", err)
+		s.logger.Warn("signal forward failed", "signal", sysSignal, "pid", s.pid, "err", err)
+	}
+}
+
+func (s *Supervisor) isStopSignal(sig syscall.Signal) bool {
+	switch sig {
+	case syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL:
+		return true
+	}
+	return sig == s.StopSignal
+}
+
+// Restarts returns the workload's restart count and last exit reason.
+func (s *Supervisor) Restarts() (int, string) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	return s.result.RestartCount, s.result.LastExitReason
+}
+
+// exitReason describes how a process ended, e.g. "exited with code 1".
+func exitReason(ws unix.WaitStatus, oom bool) string {
+	switch {
+	case oom:
+		return "OOM killed"
+	case ws.Signaled():
+		return "killed by " + unix.SignalName(ws.Signal())
+	default:
+		return fmt.Sprintf("exited with code %d", ws.ExitStatus())
+	}
+}
+
+// ParseSignal parses a signal name ("SIGQUIT" or "QUIT") or number.
+func ParseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 64 {
+			return 0, fmt.Errorf("signal %d out of range", n)
+		}
+		return syscall.Signal(n), nil
+	}
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("unknown signal %q", s)
 	}
+	return sig, nil
 }
 
 // checkOOM reads /dev/kmsg looking for OOM kill of the given PID.
@@ -0,0 +1,53 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCreateDir(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	base := t.TempDir()
+	dir := filepath.Join(base, "app", "data")
+
+	if err := createDir(dir, 1000, 1001); err != nil {
+		t.Fatalf("createDir: %v", err)
+	}
+	for _, p := range []string{filepath.Join(base, "app"), dir} {
+		st, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("stat %s: %v", p, err)
+		}
+		sys := st.Sys().(*syscall.Stat_t)
+		if !st.IsDir() || sys.Uid != 1000 || sys.Gid != 1001 {
+			t.Errorf("%s: got dir=%v owner %d:%d, want directory owned by 1000:1001", p, st.IsDir(), sys.Uid, sys.Gid)
+		}
+	}
+	st, _ := os.Stat(base)
+	if st.Sys().(*syscall.Stat_t).Uid != 0 {
+		t.Error("createDir changed the owner of an existing directory")
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for in, want := range map[string]syscall.Signal{
+		"SIGQUIT":  syscall.SIGQUIT,
+		"quit":     syscall.SIGQUIT,
+		"SIGWINCH": syscall.SIGWINCH,
+		"15":       syscall.SIGTERM,
+	} {
+		got, err := ParseSignal(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSignal(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "SIGNOPE", "0", "65"} {
+		if _, err := ParseSignal(in); err == nil {
+			t.Errorf("ParseSignal(%q): expected error", in)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package process
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// Restart policies.
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// Backoff between restarts, as Docker does it: doubling from
+// initialBackoff up to maxBackoff, back to the start once a run lasts
+// stableRun.
+const (
+	initialBackoff = 100 * time.Millisecond
+	maxBackoff     = time.Minute
+	stableRun      = 10 * time.Second
+)
+
+type RestartPolicy struct {
+	Policy     string
+	MaxRetries int // on-failure only; 0 is unlimited
+}
+
+// ParseRestartPolicy validates a config restart policy. Nil means never.
+func ParseRestartPolicy(p *config.RestartPolicy) (RestartPolicy, error) {
+	if p == nil {
+		return RestartPolicy{Policy: RestartNever}, nil
+	}
+	out := RestartPolicy{Policy: p.Policy, MaxRetries: p.MaxRetries}
+	switch p.Policy {
+	case "":
+		out.Policy = RestartNever
+	case RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return out, fmt.Errorf("unknown restart policy %q", p.Policy)
+	}
+	if p.MaxRetries < 0 {
+		return out, fmt.Errorf("negative MaxRetries %d", p.MaxRetries)
+	}
+	return out, nil
+}
+
+// restarter tracks restarts of one process under a policy.
+type restarter struct {
+	policy  RestartPolicy
+	count   int
+	backoff time.Duration
+}
+
+// next reports whether a process that exited with code after running for
+// ran should be restarted, and after what delay. A true result counts as a
+// restart.
+func (r *restarter) next(code int, ran time.Duration) (time.Duration, bool) {
+	switch r.policy.Policy {
+	case RestartAlways:
+	case RestartOnFailure:
+		if code == 0 {
+			return 0, false
+		}
+		if r.policy.MaxRetries > 0 && r.count >= r.policy.MaxRetries {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if r.backoff == 0 || ran >= stableRun {
+		r.backoff = initialBackoff
+	} else {
+		r.backoff = min(r.backoff*2, maxBackoff)
+	}
+	r.count++
+	return r.backoff, true
+}
@@ -0,0 +1,202 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	p, err := ParseRestartPolicy(nil)
+	if err != nil || p.Policy != RestartNever {
+		t.Errorf("nil: got %+v, %v; want never", p, err)
+	}
+	p, err = ParseRestartPolicy(&config.RestartPolicy{Policy: "on-failure", MaxRetries: 3})
+	if err != nil || p.Policy != RestartOnFailure || p.MaxRetries != 3 {
+		t.Errorf("on-failure: got %+v, %v", p, err)
+	}
+	for _, bad := range []config.RestartPolicy{{Policy: "sometimes"}, {Policy: "always", MaxRetries: -1}} {
+		if _, err := ParseRestartPolicy(&bad); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
+
+func TestRestarter_OnFailure(t *testing.T) {
+	r := restarter{policy: RestartPolicy{Policy: RestartOnFailure, MaxRetries: 2}}
+	if _, ok := r.next(0, 0); ok {
+		t.Error("restarted after a clean exit")
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := r.next(1, 0); !ok {
+			t.Fatalf("retry %d: not restarted", i+1)
+		}
+	}
+	if _, ok := r.next(1, 0); ok {
+		t.Error("restarted past MaxRetries")
+	}
+	if r.count != 2 {
+		t.Errorf("count = %d, want 2", r.count)
+	}
+}
+
+func TestRestarter_Backoff(t *testing.T) {
+	r := restarter{policy: RestartPolicy{Policy: RestartAlways}}
+	var got []time.Duration
+	for i := 0; i < 3; i++ {
+		d, _ := r.next(0, 0)
+		got = append(got, d)
+	}
+	want := []time.Duration{initialBackoff, 2 * initialBackoff, 4 * initialBackoff}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("delays = %v, want %v", got, want)
+			break
+		}
+	}
+	if d, _ := r.next(0, stableRun); d != initialBackoff {
+		t.Errorf("after a stable run: delay %v, want %v", d, initialBackoff)
+	}
+	r.backoff = maxBackoff
+	if d, _ := r.next(0, 0); d != maxBackoff {
+		t.Errorf("delay %v, want cap %v", d, maxBackoff)
+	}
+}
+
+func TestRestarter_Never(t *testing.T) {
+	r := restarter{policy: RestartPolicy{Policy: RestartNever}}
+	if _, ok := r.next(1, 0); ok {
+		t.Error("restarted under never")
+	}
+}
+
+func TestSupervisor_RestartsWorkload(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runs := filepath.Join(t.TempDir(), "runs")
+
+	sup, err := New([]string{"sh", "-c", "echo run >> " + runs + "; exit 3"}, Spec{}, logger)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	sup.Restart = RestartPolicy{Policy: RestartOnFailure, MaxRetries: 2}
+	if err := sup.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	res := sup.Run()
+
+	want := Result{ExitCode: 3, RestartCount: 2, LastExitReason: "exited with code 3"}
+	if res != want {
+		t.Errorf("result = %+v, want %+v", res, want)
+	}
+	data, _ := os.ReadFile(runs)
+	if n := strings.Count(string(data), "run"); n != 3 {
+		t.Errorf("workload ran %d times, want 3", n)
+	}
+}
+
+func TestSupervisor_KillsLeftoversBeforeRestart(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	pids := filepath.Join(t.TempDir(), "pids")
+
+	sup, err := New([]string{"sh", "-c", "sleep 60 & echo $! >> " + pids + "; exit 3"}, Spec{}, logger)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	sup.Restart = RestartPolicy{Policy: RestartOnFailure, MaxRetries: 1}
+	if err := sup.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	sup.Run()
+
+	data, _ := os.ReadFile(pids)
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		t.Fatalf("pids: got %q, want two runs", data)
+	}
+	last, _ := strconv.Atoi(fields[1])
+	defer syscall.Kill(last, syscall.SIGKILL)
+
+	first, _ := strconv.Atoi(fields[0])
+	deadline := time.Now().Add(2 * time.Second)
+	for alive(first) {
+		if time.Now().After(deadline) {
+			t.Fatal("first run's background process survived the restart")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// alive reports whether pid exists and isn't a zombie.
+func alive(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestSupervisor_StopSignalDisablesRestart(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sup, err := New([]string{"sleep", "60"}, Spec{}, logger)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	sup.Restart = RestartPolicy{Policy: RestartAlways}
+	if err := sup.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	sup.SignalCh <- syscall.SIGTERM
+
+	done := make(chan Result)
+	go func() { done <- sup.Run() }()
+	select {
+	case res := <-done:
+		if res.RestartCount != 0 || res.LastExitReason != "killed by SIGTERM" {
+			t.Errorf("result = %+v, want a single run killed by SIGTERM", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("workload restarted after SIGTERM")
+	}
+}
+
+func TestSupervisor_SignalChMapsStopSignal(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ready := filepath.Join(t.TempDir(), "ready")
+	sup, err := New([]string{"sh", "-c", "trap 'exit 5' USR1; touch " + ready + "; while :; do sleep 0.05; done"}, Spec{}, logger)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	sup.StopSignal = syscall.SIGUSR1
+	if err := sup.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	sup.SignalCh <- syscall.SIGTERM
+
+	done := make(chan Result)
+	go func() { done <- sup.Run() }()
+	select {
+	case res := <-done:
+		if res.ExitCode != 5 {
+			t.Errorf("result = %+v, want exit 5 from the StopSignal trap", res)
+		}
+	case <-time.After(5 * time.Second):
+		sup.SignalCh <- syscall.SIGKILL
+		t.Fatal("workload ignored SIGTERM mapped to StopSignal")
+	}
+}
@@ -0,0 +1,64 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+var rlimitResources = map[string]int{
+	"as":         unix.RLIMIT_AS,
+	"core":       unix.RLIMIT_CORE,
+	"cpu":        unix.RLIMIT_CPU,
+	"data":       unix.RLIMIT_DATA,
+	"fsize":      unix.RLIMIT_FSIZE,
+	"locks":      unix.RLIMIT_LOCKS,
+	"memlock":    unix.RLIMIT_MEMLOCK,
+	"msgqueue":   unix.RLIMIT_MSGQUEUE,
+	"nice":       unix.RLIMIT_NICE,
+	"nofile":     unix.RLIMIT_NOFILE,
+	"nproc":      unix.RLIMIT_NPROC,
+	"rss":        unix.RLIMIT_RSS,
+	"rtprio":     unix.RLIMIT_RTPRIO,
+	"rttime":     unix.RLIMIT_RTTIME,
+	"sigpending": unix.RLIMIT_SIGPENDING,
+	"stack":      unix.RLIMIT_STACK,
+}
+
+type Rlimit struct {
+	Name     string `json:"name"`
+	Resource int    `json:"resource"`
+	Soft     uint64 `json:"soft"`
+	Hard     uint64 `json:"hard"`
+}
+
+// ParseRlimits converts config rlimits keyed by name ("nofile" or
+// "RLIMIT_NOFILE"). Negative values mean unlimited.
+func ParseRlimits(limits map[string]config.Rlimit) ([]Rlimit, error) {
+	var out []Rlimit
+	for name, l := range limits {
+		key := strings.TrimPrefix(strings.ToLower(name), "rlimit_")
+		res, ok := rlimitResources[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown rlimit %q", name)
+		}
+		soft, hard := rlimitValue(l.Soft), rlimitValue(l.Hard)
+		if soft > hard {
+			return nil, fmt.Errorf("rlimit %s: soft limit %d exceeds hard limit %d", key, l.Soft, l.Hard)
+		}
+		out = append(out, Rlimit{Name: key, Resource: res, Soft: soft, Hard: hard})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func rlimitValue(v int64) uint64 {
+	if v < 0 {
+		return unix.RLIM_INFINITY
+	}
+	return uint64(v)
+}
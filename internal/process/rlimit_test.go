@@ -0,0 +1,50 @@
+//go:build linux
+
+package process
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+func TestParseRlimits(t *testing.T) {
+	got, err := ParseRlimits(map[string]config.Rlimit{
+		"nofile":         {Soft: 65536, Hard: 65536},
+		"RLIMIT_MEMLOCK": {Soft: -1, Hard: -1},
+		"Core":           {Soft: 0, Hard: 0},
+	})
+	if err != nil {
+		t.Fatalf("ParseRlimits: %v", err)
+	}
+	want := []Rlimit{
+		{Name: "core", Resource: unix.RLIMIT_CORE, Soft: 0, Hard: 0},
+		{Name: "memlock", Resource: unix.RLIMIT_MEMLOCK, Soft: unix.RLIM_INFINITY, Hard: unix.RLIM_INFINITY},
+		{Name: "nofile", Resource: unix.RLIMIT_NOFILE, Soft: 65536, Hard: 65536},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParseRlimits: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("rlimit %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseRlimits_Unknown(t *testing.T) {
+	if _, err := ParseRlimits(map[string]config.Rlimit{"bogus": {}}); err == nil {
+		t.Error("ParseRlimits(bogus): expected error")
+	}
+}
+
+func TestParseRlimits_SoftAboveHard(t *testing.T) {
+	if _, err := ParseRlimits(map[string]config.Rlimit{"nofile": {Soft: 2048, Hard: 1024}}); err == nil {
+		t.Error("ParseRlimits(soft > hard): expected error")
+	}
+	if _, err := ParseRlimits(map[string]config.Rlimit{"nofile": {Soft: -1, Hard: 1024}}); err == nil {
+		t.Error("ParseRlimits(unlimited soft, finite hard): expected error")
+	}
+}
@@ -0,0 +1,105 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+const (
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+)
+
+var ioprioClasses = map[string]int{
+	"realtime":    1,
+	"rt":          1,
+	"best-effort": 2,
+	"be":          2,
+	"idle":        3,
+}
+
+// Scheduling holds the scheduling attributes applied by the spawn helper.
+type Scheduling struct {
+	OOMScoreAdj int   `json:"oom_score_adj,omitempty"`
+	Nice        *int  `json:"nice,omitempty"`
+	CPUs        []int `json:"cpus,omitempty"`
+	IOPrio      int   `json:"ioprio,omitempty"` // 0 leaves the default
+}
+
+// ParseScheduling validates a config scheduling block. A nil block still
+// yields an oom_score_adj of 0, so children don't inherit init's.
+func ParseScheduling(sched *config.Scheduling) (*Scheduling, error) {
+	out := &Scheduling{}
+	if sched == nil {
+		return out, nil
+	}
+	if sched.OOMScoreAdj != nil {
+		if v := *sched.OOMScoreAdj; v < -1000 || v > 1000 {
+			return nil, fmt.Errorf("oom_score_adj %d out of range [-1000, 1000]", v)
+		}
+		out.OOMScoreAdj = *sched.OOMScoreAdj
+	}
+	if sched.Nice != nil {
+		if v := *sched.Nice; v < -20 || v > 19 {
+			return nil, fmt.Errorf("nice %d out of range [-20, 19]", v)
+		}
+		out.Nice = sched.Nice
+	}
+	for _, cpu := range sched.CPUAffinity {
+		if cpu < 0 || cpu >= 1024 {
+			return nil, fmt.Errorf("cpu %d out of range", cpu)
+		}
+		out.CPUs = append(out.CPUs, cpu)
+	}
+	if p := sched.IOPriority; p != nil {
+		class, ok := ioprioClasses[strings.ToLower(p.Class)]
+		if !ok {
+			return nil, fmt.Errorf("unknown I/O priority class %q", p.Class)
+		}
+		if p.Level < 0 || p.Level > 7 {
+			return nil, fmt.Errorf("I/O priority level %d out of range [0, 7]", p.Level)
+		}
+		out.IOPrio = class<<ioprioClassShift | p.Level
+	}
+	return out, nil
+}
+
+// SetOOMScoreAdj writes the calling process's oom_score_adj.
+func SetOOMScoreAdj(adj int) error {
+	return os.WriteFile("/proc/self/oom_score_adj", []byte(strconv.Itoa(adj)), 0)
+}
+
+// apply sets the attributes on the calling thread, which is the one that
+// execs the target. Lowering oom_score_adj and nice needs root, so this runs
+// before credentials are dropped.
+func (s *Scheduling) apply() error {
+	if err := SetOOMScoreAdj(s.OOMScoreAdj); err != nil {
+		return fmt.Errorf("set oom_score_adj: %w", err)
+	}
+	if s.Nice != nil {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, *s.Nice); err != nil {
+			return fmt.Errorf("set nice %d: %w", *s.Nice, err)
+		}
+	}
+	if len(s.CPUs) > 0 {
+		var set unix.CPUSet
+		for _, cpu := range s.CPUs {
+			set.Set(cpu)
+		}
+		if err := unix.SchedSetaffinity(0, &set); err != nil {
+			return fmt.Errorf("set cpu affinity %v: %w", s.CPUs, err)
+		}
+	}
+	if s.IOPrio != 0 {
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(s.IOPrio)); errno != 0 {
+			return fmt.Errorf("set ioprio: %w", errno)
+		}
+	}
+	return nil
+}
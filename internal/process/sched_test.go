@@ -0,0 +1,48 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestParseScheduling(t *testing.T) {
+	sched, err := ParseScheduling(&config.Scheduling{
+		OOMScoreAdj: intPtr(500),
+		Nice:        intPtr(5),
+		CPUAffinity: []int{0, 2},
+		IOPriority:  &config.IOPriority{Class: "best-effort", Level: 7},
+	})
+	if err != nil {
+		t.Fatalf("ParseScheduling: %v", err)
+	}
+	want := &Scheduling{OOMScoreAdj: 500, Nice: intPtr(5), CPUs: []int{0, 2}, IOPrio: 2<<13 | 7}
+	if !reflect.DeepEqual(sched, want) {
+		t.Errorf("got %+v, want %+v", sched, want)
+	}
+}
+
+func TestParseScheduling_NilResetsOOMScore(t *testing.T) {
+	sched, err := ParseScheduling(nil)
+	if err != nil || sched == nil || sched.OOMScoreAdj != 0 {
+		t.Errorf("ParseScheduling(nil): got %+v, %v", sched, err)
+	}
+}
+
+func TestParseScheduling_Errors(t *testing.T) {
+	tests := map[string]*config.Scheduling{
+		"oom":   {OOMScoreAdj: intPtr(-1001)},
+		"nice":  {Nice: intPtr(20)},
+		"cpu":   {CPUAffinity: []int{-1}},
+		"class": {IOPriority: &config.IOPriority{Class: "urgent"}},
+		"level": {IOPriority: &config.IOPriority{Class: "rt", Level: 8}},
+	}
+	for name, sched := range tests {
+		if _, err := ParseScheduling(sched); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
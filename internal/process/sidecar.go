@@ -0,0 +1,262 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// Sidecar is a process supervised next to the workload. It is restarted
+// per its policy and doesn't affect the VM's lifecycle.
+type Sidecar struct {
+	Name      string
+	Argv      []string
+	Spec      Spec
+	Restart   RestartPolicy
+	AfterMain bool // started after the workload rather than before
+}
+
+type sidecar struct {
+	Sidecar
+	pid     int
+	started time.Time
+	restart restarter
+}
+
+// Order validates procs and returns them in start order: dependencies
+// first, otherwise in list order. Without a Main entry, an implicit one
+// named "workload" is appended.
+func Order(procs []config.Process) ([]config.Process, error) {
+	index := make(map[string]int, len(procs))
+	hasMain := false
+	for i, p := range procs {
+		if p.Name == "" {
+			return nil, fmt.Errorf("process %d: missing Name", i)
+		}
+		if strings.Contains(p.Name, "/") {
+			return nil, fmt.Errorf("process %q: Name can't contain '/'", p.Name)
+		}
+		if _, ok := index[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate process %q", p.Name)
+		}
+		index[p.Name] = i
+		if p.Main {
+			if hasMain {
+				return nil, fmt.Errorf("more than one Main process")
+			}
+			hasMain = true
+			if p.Resources != nil {
+				return nil, fmt.Errorf("process %q: the main process takes the top-level Resources", p.Name)
+			}
+		} else if len(p.Cmd) == 0 {
+			return nil, fmt.Errorf("process %q: missing Cmd", p.Name)
+		}
+	}
+	if !hasMain {
+		if _, ok := index["workload"]; ok {
+			return nil, fmt.Errorf(`process name "workload" is reserved without a Main process`)
+		}
+		index["workload"] = len(procs)
+		procs = append(procs[:len(procs):len(procs)], config.Process{Name: "workload", Main: true})
+	}
+	for _, p := range procs {
+		for _, dep := range p.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("process %q depends on unknown process %q", p.Name, dep)
+			}
+		}
+	}
+
+	// Depth-first, visiting in list order, so ties keep the list order.
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(procs))
+	var out []config.Process
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle through process %q", procs[i].Name)
+		}
+		state[i] = visiting
+		for _, dep := range procs[i].DependsOn {
+			if err := visit(index[dep]); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		out = append(out, procs[i])
+		return nil
+	}
+	for i := range procs {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// AddSidecar registers a sidecar to be started with the workload. Sidecars
+// start in the order they are added and stop in reverse. Must be called
+// before Start.
+func (s *Supervisor) AddSidecar(sc Sidecar) {
+	s.sidecars = append(s.sidecars, &sidecar{Sidecar: sc, restart: restarter{policy: sc.Restart}})
+}
+
+// startSidecar spawns sc with its output prefixed by its name. Must be
+// called while holding s.mu.
+func (s *Supervisor) startSidecar(sc *sidecar) error {
+	cmd := sc.Spec.Command(context.Background(), sc.Argv)
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	cmd.SysProcAttr.Setsid = true
+
+	var uid, gid int
+	if sc.Spec.Identity != nil {
+		uid, gid = int(sc.Spec.Identity.UID), int(sc.Spec.Identity.GID)
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("create pipe: %w", err)
+	}
+	defer pw.Close()
+	if err := pw.Chown(uid, gid); err != nil {
+		pr.Close()
+		return fmt.Errorf("chown pipe writer: %w", err)
+	}
+	cmd.Stdout, cmd.Stderr = pw, pw
+
+	if err := cmd.Start(); err != nil {
+		pr.Close()
+		return err
+	}
+	sc.pid = cmd.Process.Pid
+	sc.started = time.Now()
+	go copyPrefixed(os.Stdout, pr, sc.Name+" | ")
+
+	s.logger.Info("sidecar started", "name", sc.Name, "pid", sc.pid, "argv", sc.Argv)
+	return nil
+}
+
+// sidecarExited handles the exit of a sidecar and schedules its restart.
+// Must be called while holding s.mu.
+func (s *Supervisor) sidecarExited(sc *sidecar, ws unix.WaitStatus) {
+	code := exitCode(ws)
+	ran := time.Since(sc.started)
+	sc.pid = 0
+	s.logger.Info("sidecar exited", "name", sc.Name, "exit_code", code)
+	if s.stopping {
+		return
+	}
+	delay, ok := sc.restart.next(code, ran)
+	if !ok {
+		return
+	}
+	s.logger.Info("restarting sidecar", "name", sc.Name, "in", delay, "restarts", sc.restart.count)
+	time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.stopping {
+			return
+		}
+		if err := s.startSidecar(sc); err != nil {
+			s.logger.Warn("restart sidecar failed", "name", sc.Name, "err", err)
+		}
+	})
+}
+
+func (s *Supervisor) sidecarByPID(pid int) *sidecar {
+	for _, sc := range s.sidecars {
+		if sc.pid == pid {
+			return sc
+		}
+	}
+	return nil
+}
+
+// StopSidecars stops running sidecars in reverse start order, sending
+// SIGTERM to each one's process group and SIGKILL after timeout. Called
+// once the workload has exited.
+func (s *Supervisor) StopSidecars(timeout time.Duration) {
+	type proc struct {
+		name string
+		pid  int
+	}
+	s.mu.Lock()
+	s.stopping = true
+	var running []proc
+	for _, sc := range s.sidecars {
+		if sc.pid != 0 {
+			running = append(running, proc{sc.Name, sc.pid})
+			sc.pid = 0
+		}
+	}
+	s.mu.Unlock()
+
+	for i := len(running) - 1; i >= 0; i-- {
+		p := running[i]
+		s.logger.Info("stopping sidecar", "name", p.name, "pid", p.pid)
+		_ = unix.Kill(-p.pid, unix.SIGTERM)
+		if !waitPID(p.pid, timeout) {
+			s.logger.Warn("sidecar did not stop, killing", "name", p.name, "pid", p.pid)
+			_ = unix.Kill(-p.pid, unix.SIGKILL)
+			waitPID(p.pid, timeout)
+		}
+	}
+}
+
+// waitPID reaps pid, polling until timeout. An already reaped pid counts
+// as exited.
+func waitPID(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		var ws unix.WaitStatus
+		got, err := unix.Wait4(pid, &ws, unix.WNOHANG, nil)
+		if got == pid || err == unix.ECHILD {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func exitCode(ws unix.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+// copyPrefixed copies r to w line by line, prefixing each line.
+func copyPrefixed(w io.Writer, r io.ReadCloser, prefix string) {
+	defer r.Close()
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			_, _ = io.WriteString(w, prefix+string(line))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
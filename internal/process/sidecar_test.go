@@ -0,0 +1,109 @@
+//go:build linux
+
+package process
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+func names(procs []config.Process) []string {
+	var out []string
+	for _, p := range procs {
+		out = append(out, p.Name)
+	}
+	return out
+}
+
+func TestOrder(t *testing.T) {
+	got, err := Order([]config.Process{
+		{Name: "app", Main: true, DependsOn: []string{"db"}},
+		{Name: "proxy", Cmd: []string{"proxy"}, DependsOn: []string{"app"}},
+		{Name: "db", Cmd: []string{"db"}},
+		{Name: "agent", Cmd: []string{"agent"}},
+	})
+	if err != nil {
+		t.Fatalf("Order: %v", err)
+	}
+	if want := []string{"db", "app", "proxy", "agent"}; !reflect.DeepEqual(names(got), want) {
+		t.Errorf("order = %v, want %v", names(got), want)
+	}
+}
+
+func TestOrder_ImplicitMain(t *testing.T) {
+	got, err := Order([]config.Process{{Name: "agent", Cmd: []string{"agent"}}})
+	if err != nil {
+		t.Fatalf("Order: %v", err)
+	}
+	if len(got) != 2 || got[1].Name != "workload" || !got[1].Main {
+		t.Errorf("got %+v, want agent then an implicit main", got)
+	}
+}
+
+func TestOrder_Errors(t *testing.T) {
+	cmd := []string{"true"}
+	for name, procs := range map[string][]config.Process{
+		"no name":   {{Cmd: cmd}},
+		"slash":     {{Name: "a/b", Cmd: cmd}},
+		"main res":  {{Name: "a", Main: true, Resources: &config.Resources{PidsMax: 1}}},
+		"duplicate": {{Name: "a", Cmd: cmd}, {Name: "a", Cmd: cmd}},
+		"two mains": {{Name: "a", Main: true}, {Name: "b", Main: true}},
+		"no cmd":    {{Name: "a"}},
+		"reserved":  {{Name: "workload", Cmd: cmd}},
+		"unknown":   {{Name: "a", Cmd: cmd, DependsOn: []string{"b"}}},
+		"cycle":     {{Name: "a", Cmd: cmd, DependsOn: []string{"b"}}, {Name: "b", Cmd: cmd, DependsOn: []string{"a"}}},
+	} {
+		if _, err := Order(procs); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSupervisor_RestartsSidecar(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runs := filepath.Join(t.TempDir(), "runs")
+
+	sup, err := New([]string{"sleep", "1"}, Spec{}, logger)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	sup.AddSidecar(Sidecar{
+		Name:    "tick",
+		Argv:    []string{"sh", "-c", "echo run >> " + runs},
+		Restart: RestartPolicy{Policy: RestartAlways},
+	})
+	sup.AddSidecar(Sidecar{Name: "idle", Argv: []string{"sleep", "60"}, AfterMain: true})
+	if err := sup.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	sup.Run()
+
+	start := time.Now()
+	sup.StopSidecars(5 * time.Second)
+	if time.Since(start) > 2*time.Second {
+		t.Error("idle sidecar was not stopped by SIGTERM")
+	}
+	data, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatalf("read runs: %v", err)
+	}
+	if n := strings.Count(string(data), "run"); n < 2 {
+		t.Errorf("sidecar ran %d times, want restarts", n)
+	}
+}
+
+func TestCopyPrefixed(t *testing.T) {
+	var out strings.Builder
+	copyPrefixed(&out, io.NopCloser(strings.NewReader("one\ntwo")), "db | ")
+	if want := "db | one\ndb | two\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,185 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+const defaultMode = 0644
+
+// Data is the model templates are executed against.
+type Data struct {
+	Config   *config.RunConfig
+	Env      map[string]string // the workload env as built at boot
+	Hostname string
+	Network  Network
+}
+
+type Network struct {
+	PrivateIP  string // first IPConfigs address
+	Interfaces []Interface
+}
+
+type Interface struct {
+	Name  string
+	MTU   int
+	Addrs []string // CIDR notation
+}
+
+// Renderer writes the config's templates, owned by the workload user.
+type Renderer struct {
+	env      map[string]string
+	uid, gid int
+	logger   *slog.Logger
+
+	mu sync.Mutex // serializes renders
+}
+
+func New(env []string, uid, gid uint32, logger *slog.Logger) *Renderer {
+	m := make(map[string]string, len(env))
+	for _, e := range env {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			m[k] = v
+		}
+	}
+	return &Renderer{env: m, uid: int(uid), gid: int(gid), logger: logger}
+}
+
+// Render executes every template in cfg and writes the results. All
+// templates are executed before any file is written, so an error leaves
+// the previous files in place. Returns the written paths.
+func (r *Renderer) Render(cfg *config.RunConfig) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(cfg.Templates) == 0 {
+		return nil, nil
+	}
+	data := r.data(cfg)
+
+	type file struct {
+		path    string
+		mode    os.FileMode
+		content []byte
+	}
+	var files []file
+	for _, t := range cfg.Templates {
+		content, err := execute(t, data)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Path, err)
+		}
+		mode, err := parseMode(t.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Path, err)
+		}
+		files = append(files, file{t.Path, mode, content})
+	}
+
+	var written []string
+	for _, f := range files {
+		if err := r.write(f.path, f.content, f.mode); err != nil {
+			return written, fmt.Errorf("write %s: %w", f.path, err)
+		}
+		written = append(written, f.path)
+	}
+	r.logger.Info("templates rendered", "paths", written)
+	return written, nil
+}
+
+func (r *Renderer) data(cfg *config.RunConfig) Data {
+	d := Data{Config: cfg, Env: r.env, Hostname: cfg.Hostname}
+	if d.Hostname == "" {
+		d.Hostname, _ = os.Hostname()
+	}
+	if len(cfg.IPConfigs) > 0 {
+		d.Network.PrivateIP = cfg.IPConfigs[0].IP
+	}
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		i := Interface{Name: iface.Name, MTU: iface.MTU}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			i.Addrs = append(i.Addrs, a.String())
+		}
+		d.Network.Interfaces = append(d.Network.Interfaces, i)
+	}
+	return d
+}
+
+func execute(t config.Template, data Data) ([]byte, error) {
+	if !filepath.IsAbs(t.Path) {
+		return nil, fmt.Errorf("path must be absolute")
+	}
+	text := t.Template
+	if text == "" {
+		if t.Source == "" {
+			return nil, fmt.Errorf("neither Template nor Source set")
+		}
+		src, err := os.ReadFile(t.Source)
+		if err != nil {
+			return nil, err
+		}
+		text = string(src)
+	}
+	tmpl, err := template.New(filepath.Base(t.Path)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return defaultMode, nil
+	}
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0777 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	return os.FileMode(v), nil
+}
+
+// write replaces path atomically so readers never see a partial file.
+func (r *Renderer) write(path string, content []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op after the rename
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chown(r.uid, r.gid); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
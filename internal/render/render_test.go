@@ -0,0 +1,90 @@
+package render
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+func newTestRenderer(env ...string) *Renderer {
+	return New(env, uint32(os.Getuid()), uint32(os.Getgid()), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app.conf.tmpl")
+	if err := os.WriteFile(src, []byte("port={{.Env.PORT}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.RunConfig{
+		Hostname:  "web-1",
+		IPConfigs: []config.IPConfig{{IP: "10.0.0.2", Mask: 24}},
+		Templates: []config.Template{
+			{Path: filepath.Join(dir, "hosts"), Template: "{{.Network.PrivateIP}} {{.Hostname}}\n"},
+			{Path: filepath.Join(dir, "sub/app.conf"), Source: src, Mode: "0600"},
+			{Path: filepath.Join(dir, "ifaces"), Template: "{{range .Network.Interfaces}}{{if eq .Name \"lo\"}}{{.Name}}{{end}}{{end}}"},
+		},
+	}
+
+	written, err := newTestRenderer("PORT=8080").Render(cfg)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if len(written) != 3 {
+		t.Errorf("written: got %v", written)
+	}
+	for path, want := range map[string]string{
+		"hosts":        "10.0.0.2 web-1\n",
+		"sub/app.conf": "port=8080\n",
+		"ifaces":       "lo",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v; want %q", path, got, err, want)
+		}
+	}
+	st, _ := os.Stat(filepath.Join(dir, "sub/app.conf"))
+	if st.Mode().Perm() != 0600 {
+		t.Errorf("mode: got %o, want 600", st.Mode().Perm())
+	}
+}
+
+func TestRender_ErrorKeepsFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a")
+	r := newTestRenderer()
+
+	if _, err := r.Render(&config.RunConfig{Hostname: "old", Templates: []config.Template{{Path: path, Template: "{{.Hostname}}"}}}); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	_, err := r.Render(&config.RunConfig{Hostname: "new", Templates: []config.Template{
+		{Path: path, Template: "{{.Hostname}}"},
+		{Path: filepath.Join(dir, "b"), Template: "{{.Env.MISSING}}"},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "MISSING") {
+		t.Errorf("Render with missing key: got %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "old" {
+		t.Errorf("a: got %q, want old", got)
+	}
+}
+
+func TestRender_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for _, tmpl := range []config.Template{
+		{Path: "relative", Template: "x"},
+		{Path: filepath.Join(dir, "x")},
+		{Path: filepath.Join(dir, "x"), Template: "{{"},
+		{Path: filepath.Join(dir, "x"), Template: "x", Mode: "999"},
+		{Path: filepath.Join(dir, "x"), Source: filepath.Join(dir, "missing")},
+	} {
+		if _, err := newTestRenderer().Render(&config.RunConfig{Templates: []config.Template{tmpl}}); err == nil {
+			t.Errorf("Render(%+v): expected error", tmpl)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package seccomp
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// assembler emits classic BPF with forward jumps to labels, resolved into
+// the 8-bit jt/jf offsets by assemble.
+type assembler struct {
+	prog   []unix.SockFilter
+	labels []int
+	jumps  []jumpFixup
+}
+
+type jumpFixup struct {
+	pc     int
+	jt, jf int // labels
+}
+
+func (a *assembler) label() int {
+	a.labels = append(a.labels, -1)
+	return len(a.labels) - 1
+}
+
+func (a *assembler) bind(l int) {
+	a.labels[l] = len(a.prog)
+}
+
+func (a *assembler) stmt(code uint16, k uint32) {
+	a.prog = append(a.prog, unix.SockFilter{Code: code, K: k})
+}
+
+func (a *assembler) jump(op uint16, k uint32, jt, jf int) {
+	a.jumps = append(a.jumps, jumpFixup{pc: len(a.prog), jt: jt, jf: jf})
+	a.prog = append(a.prog, unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, K: k})
+}
+
+func (a *assembler) assemble() ([]unix.SockFilter, error) {
+	if len(a.prog) > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("filter too large: %d instructions", len(a.prog))
+	}
+	for _, j := range a.jumps {
+		for _, f := range []struct {
+			label int
+			off   *uint8
+		}{{j.jt, &a.prog[j.pc].Jt}, {j.jf, &a.prog[j.pc].Jf}} {
+			target := a.labels[f.label]
+			d := target - j.pc - 1
+			if target < 0 || d < 0 || d > 255 {
+				return nil, fmt.Errorf("jump at %d out of range", j.pc)
+			}
+			*f.off = uint8(d)
+		}
+	}
+	return a.prog, nil
+}
+
+// rejectIf returns ENOSYS when comparing A against k gives cond.
+func (a *assembler) rejectIf(op uint16, k uint32, cond bool) {
+	reject, ok := a.label(), a.label()
+	if cond {
+		a.jump(op, k, reject, ok)
+	} else {
+		a.jump(op, k, ok, reject)
+	}
+	a.bind(reject)
+	a.stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS))
+	a.bind(ok)
+}
+
+// rule emits: if nr matches and every arg condition holds, return act.
+func (a *assembler) rule(nr uint32, args []Arg, act uint32) error {
+	fail := a.label()
+	match := a.label()
+	a.stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offNr)
+	a.jump(unix.BPF_JEQ, nr, match, fail)
+	a.bind(match)
+	for _, arg := range args {
+		if err := a.arg(arg, fail); err != nil {
+			return err
+		}
+	}
+	a.stmt(unix.BPF_RET|unix.BPF_K, act)
+	a.bind(fail)
+	return nil
+}
+
+// arg emits a 64-bit comparison of a syscall argument that falls through
+// when it holds and jumps to fail otherwise.
+func (a *assembler) arg(arg Arg, fail int) error {
+	if arg.Index > 5 {
+		return fmt.Errorf("arg index %d out of range", arg.Index)
+	}
+	lo := uint32(offArgs + 8*arg.Index)
+	hi := lo + 4
+	v := arg.Value
+	if arg.Op == "SCMP_CMP_MASKED_EQ" {
+		v = arg.ValueTwo
+	}
+	vhi, vlo := uint32(v>>32), uint32(v)
+
+	next := a.label()
+	l1, l2 := a.label(), a.label()
+	ld := func(off uint32) { a.stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, off) }
+
+	switch arg.Op {
+	case "SCMP_CMP_EQ":
+		ld(hi)
+		a.jump(unix.BPF_JEQ, vhi, l1, fail)
+		a.bind(l1)
+		ld(lo)
+		a.jump(unix.BPF_JEQ, vlo, next, fail)
+	case "SCMP_CMP_NE":
+		ld(hi)
+		a.jump(unix.BPF_JEQ, vhi, l1, next)
+		a.bind(l1)
+		ld(lo)
+		a.jump(unix.BPF_JEQ, vlo, fail, next)
+	case "SCMP_CMP_GT", "SCMP_CMP_GE":
+		op := uint16(unix.BPF_JGT)
+		if arg.Op == "SCMP_CMP_GE" {
+			op = unix.BPF_JGE
+		}
+		ld(hi)
+		a.jump(unix.BPF_JGT, vhi, next, l1)
+		a.bind(l1)
+		a.jump(unix.BPF_JEQ, vhi, l2, fail)
+		a.bind(l2)
+		ld(lo)
+		a.jump(op, vlo, next, fail)
+	case "SCMP_CMP_LT", "SCMP_CMP_LE":
+		// LT is !GE and LE is !GT.
+		op := uint16(unix.BPF_JGE)
+		if arg.Op == "SCMP_CMP_LE" {
+			op = unix.BPF_JGT
+		}
+		ld(hi)
+		a.jump(unix.BPF_JGT, vhi, fail, l1)
+		a.bind(l1)
+		a.jump(unix.BPF_JEQ, vhi, l2, next)
+		a.bind(l2)
+		ld(lo)
+		a.jump(op, vlo, fail, next)
+	case "SCMP_CMP_MASKED_EQ":
+		mhi, mlo := uint32(arg.Value>>32), uint32(arg.Value)
+		ld(hi)
+		a.stmt(unix.BPF_ALU|unix.BPF_AND|unix.BPF_K, mhi)
+		a.jump(unix.BPF_JEQ, vhi, l1, fail)
+		a.bind(l1)
+		ld(lo)
+		a.stmt(unix.BPF_ALU|unix.BPF_AND|unix.BPF_K, mlo)
+		a.jump(unix.BPF_JEQ, vlo, next, fail)
+	default:
+		return fmt.Errorf("unsupported op %q", arg.Op)
+	}
+	a.bind(next)
+	return nil
+}
@@ -0,0 +1,60 @@
+//go:build ignore
+
+// mksyscalls generates the syscall name tables from golang.org/x/sys/unix.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var sysnum = regexp.MustCompile(`^\s*SYS_(\w+)\s*=\s*(\d+)`)
+
+var audit = map[string]string{
+	"amd64": "AUDIT_ARCH_X86_64",
+	"arm64": "AUDIT_ARCH_AARCH64",
+}
+
+func main() {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "golang.org/x/sys").Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir := filepath.Join(strings.TrimSpace(string(out)), "unix")
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		f, err := os.Open(filepath.Join(dir, "zsysnum_linux_"+arch+".go"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "// Code generated by mksyscalls.go; DO NOT EDIT.\n\n")
+		fmt.Fprintf(&b, "package seccomp\n\nimport \"golang.org/x/sys/unix\"\n\n")
+		fmt.Fprintf(&b, "const nativeArch = unix.%s\n\n", audit[arch])
+		fmt.Fprintf(&b, "var syscallNumbers = map[string]uint32{\n")
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if m := sysnum.FindStringSubmatch(s.Text()); m != nil {
+				fmt.Fprintf(&b, "%q: %s,\n", strings.ToLower(m[1]), m[2])
+			}
+		}
+		f.Close()
+		fmt.Fprintf(&b, "}\n")
+
+		src, err := format.Source(b.Bytes())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile("zsyscalls_linux_"+arch+".go", src, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Package seccomp compiles OCI/Docker JSON seccomp profiles to classic BPF
+// for the native architecture and installs them.
+package seccomp
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+//go:generate go run mksyscalls.go
+
+//go:embed default.json
+var defaultProfile []byte
+
+// Profile is an OCI/Docker seccomp profile.
+type Profile struct {
+	DefaultAction   string    `json:"defaultAction"`
+	DefaultErrnoRet *uint     `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string  `json:"architectures,omitempty"`
+	Syscalls        []Syscall `json:"syscalls,omitempty"`
+}
+
+type Syscall struct {
+	Names    []string `json:"names"`
+	Action   string   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []Arg    `json:"args,omitempty"`
+	Includes *Filter  `json:"includes,omitempty"`
+	Excludes *Filter  `json:"excludes,omitempty"`
+}
+
+type Arg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo,omitempty"`
+	Op       string `json:"op"`
+}
+
+// Filter restricts a rule to some architectures, capabilities or kernels.
+type Filter struct {
+	Arches    []string `json:"arches,omitempty"`
+	Caps      []string `json:"caps,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+var archNames = map[uint32][]string{
+	unix.AUDIT_ARCH_X86_64:  {"SCMP_ARCH_X86_64", "amd64"},
+	unix.AUDIT_ARCH_AARCH64: {"SCMP_ARCH_AARCH64", "arm64"},
+}
+
+// Load parses the configured profile: inline, a file in the rootfs, or the
+// built-in default when neither is set.
+func Load(cfg *config.Seccomp) (*Profile, error) {
+	data := defaultProfile
+	switch {
+	case len(cfg.Profile) > 0:
+		data = cfg.Profile
+	case cfg.ProfilePath != "":
+		var err error
+		if data, err = os.ReadFile(cfg.ProfilePath); err != nil {
+			return nil, err
+		}
+	}
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse seccomp profile: %w", err)
+	}
+	return &p, nil
+}
+
+// Compile builds a filter for the native architecture. Rules are matched in
+// profile order. hasCap reports whether a capability (e.g. "CAP_SYS_ADMIN")
+// is in the workload's bounding set, for includes/excludes. Syscall names
+// unknown on this architecture are skipped. System calls from other ABIs
+// (32-bit compat, x32) fail with ENOSYS.
+func (p *Profile) Compile(hasCap func(string) bool) ([]unix.SockFilter, error) {
+	if len(p.Architectures) > 0 && !matchArch(p.Architectures) {
+		return nil, fmt.Errorf("profile architectures %v exclude %s", p.Architectures, archNames[nativeArch][0])
+	}
+	defAction, err := action(p.DefaultAction, p.DefaultErrnoRet)
+	if err != nil {
+		return nil, fmt.Errorf("defaultAction: %w", err)
+	}
+	release := kernelRelease()
+
+	var a assembler
+	a.stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offArch)
+	a.rejectIf(unix.BPF_JEQ, nativeArch, false)
+	if nativeArch == unix.AUDIT_ARCH_X86_64 {
+		a.stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offNr)
+		a.rejectIf(unix.BPF_JGE, x32SyscallBit, true)
+	}
+
+	for i, sc := range p.Syscalls {
+		if !sc.Includes.match(hasCap, release, true) || !sc.Excludes.match(hasCap, release, false) {
+			continue
+		}
+		act, err := action(sc.Action, sc.ErrnoRet)
+		if err != nil {
+			return nil, fmt.Errorf("syscalls[%d]: %w", i, err)
+		}
+		for _, name := range sc.Names {
+			nr, ok := syscallNumbers[name]
+			if !ok {
+				continue
+			}
+			if err := a.rule(nr, sc.Args, act); err != nil {
+				return nil, fmt.Errorf("syscalls[%d] %s: %w", i, name, err)
+			}
+		}
+	}
+	a.stmt(unix.BPF_RET|unix.BPF_K, defAction)
+
+	return a.assemble()
+}
+
+// Install loads prog into the calling thread. Non-allow actions are logged
+// by the kernel when it supports SECCOMP_FILTER_FLAG_LOG. The caller needs
+// no_new_privs or CAP_SYS_ADMIN.
+func Install(prog []unix.SockFilter) error {
+	fprog := unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	for _, flags := range []uintptr{unix.SECCOMP_FILTER_FLAG_LOG, 0} {
+		_, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, flags, uintptr(unsafe.Pointer(&fprog)))
+		if errno == 0 {
+			return nil
+		}
+		if errno != unix.EINVAL {
+			return fmt.Errorf("seccomp: %w", errno)
+		}
+	}
+	return fmt.Errorf("seccomp: %w", unix.EINVAL)
+}
+
+// Offsets into struct seccomp_data.
+const (
+	offNr   = 0
+	offArch = 4
+	offArgs = 16
+
+	x32SyscallBit = 0x40000000
+)
+
+func action(name string, errnoRet *uint) (uint32, error) {
+	errno := uint32(unix.EPERM)
+	if errnoRet != nil {
+		errno = uint32(*errnoRet) & unix.SECCOMP_RET_DATA
+	}
+	switch name {
+	case "SCMP_ACT_ALLOW":
+		return unix.SECCOMP_RET_ALLOW, nil
+	case "SCMP_ACT_LOG":
+		return unix.SECCOMP_RET_LOG, nil
+	case "SCMP_ACT_ERRNO":
+		return unix.SECCOMP_RET_ERRNO | errno, nil
+	case "SCMP_ACT_TRACE":
+		return unix.SECCOMP_RET_TRACE | errno, nil
+	case "SCMP_ACT_TRAP":
+		return unix.SECCOMP_RET_TRAP, nil
+	case "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD":
+		return unix.SECCOMP_RET_KILL_THREAD, nil
+	case "SCMP_ACT_KILL_PROCESS":
+		return unix.SECCOMP_RET_KILL_PROCESS, nil
+	}
+	return 0, fmt.Errorf("unsupported action %q", name)
+}
+
+func matchArch(arches []string) bool {
+	for _, a := range arches {
+		for _, n := range archNames[nativeArch] {
+			if a == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match reports whether f holds. An includes filter matches when every
+// condition holds, an excludes filter (want false) when none do.
+func (f *Filter) match(hasCap func(string) bool, release [2]int, want bool) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Arches) > 0 && matchArch(f.Arches) != want {
+		return false
+	}
+	for _, c := range f.Caps {
+		if hasCap(c) != want {
+			return false
+		}
+	}
+	if f.MinKernel != "" && atLeast(release, f.MinKernel) != want {
+		return false
+	}
+	return true
+}
+
+func kernelRelease() [2]int {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return [2]int{}
+	}
+	return parseVersion(unix.ByteSliceToString(uts.Release[:]))
+}
+
+func parseVersion(s string) [2]int {
+	var v [2]int
+	for i, part := range strings.SplitN(s, ".", 3) {
+		if i == 2 {
+			break
+		}
+		n := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+		if n >= 0 {
+			part = part[:n]
+		}
+		v[i], _ = strconv.Atoi(part)
+	}
+	return v
+}
+
+func atLeast(release [2]int, min string) bool {
+	m := parseVersion(min)
+	return release[0] > m[0] || release[0] == m[0] && release[1] >= m[1]
+}
@@ -0,0 +1,198 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// run interprets prog against a seccomp_data for the native architecture.
+func run(t *testing.T, prog []unix.SockFilter, arch, nr uint32, args ...uint64) uint32 {
+	t.Helper()
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[offNr:], nr)
+	binary.LittleEndian.PutUint32(data[offArch:], arch)
+	for i, a := range args {
+		binary.LittleEndian.PutUint64(data[offArgs+8*i:], a)
+	}
+
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.LittleEndian.Uint32(data[ins.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			acc &= ins.K
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K,
+			unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K,
+			unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			var ok bool
+			switch ins.Code &^ (unix.BPF_JMP | unix.BPF_K) {
+			case unix.BPF_JEQ:
+				ok = acc == ins.K
+			case unix.BPF_JGT:
+				ok = acc > ins.K
+			case unix.BPF_JGE:
+				ok = acc >= ins.K
+			}
+			if ok {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		default:
+			t.Fatalf("pc %d: unexpected opcode %#x", pc, ins.Code)
+		}
+	}
+	t.Fatal("fell off the end of the program")
+	return 0
+}
+
+func compile(t *testing.T, profile string) []unix.SockFilter {
+	t.Helper()
+	p, err := Load(&config.Seccomp{Profile: json.RawMessage(profile)})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	prog, err := p.Compile(func(string) bool { return false })
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return prog
+}
+
+func TestCompile_Actions(t *testing.T) {
+	prog := compile(t, `{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"defaultErrnoRet": 38,
+		"syscalls": [
+			{"names": ["getpid", "not_a_syscall"], "action": "SCMP_ACT_ALLOW"},
+			{"names": ["getuid"], "action": "SCMP_ACT_LOG"},
+			{"names": ["kill"], "action": "SCMP_ACT_KILL_PROCESS"}
+		]
+	}`)
+
+	tests := []struct {
+		nr   uint32
+		want uint32
+	}{
+		{syscallNumbers["getpid"], unix.SECCOMP_RET_ALLOW},
+		{syscallNumbers["getuid"], unix.SECCOMP_RET_LOG},
+		{syscallNumbers["kill"], unix.SECCOMP_RET_KILL_PROCESS},
+		{syscallNumbers["read"], unix.SECCOMP_RET_ERRNO | 38},
+	}
+	for _, tt := range tests {
+		if got := run(t, prog, nativeArch, tt.nr); got != tt.want {
+			t.Errorf("nr %d: got %#x, want %#x", tt.nr, got, tt.want)
+		}
+	}
+	if got := run(t, prog, 0x40000003, syscallNumbers["getpid"]); got != unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS) {
+		t.Errorf("foreign arch: got %#x, want ENOSYS", got)
+	}
+}
+
+func TestCompile_Args(t *testing.T) {
+	nr := syscallNumbers["personality"]
+	rule := func(op string, value, valueTwo uint64) []unix.SockFilter {
+		p := Profile{
+			DefaultAction: "SCMP_ACT_ERRNO",
+			Syscalls: []Syscall{{
+				Names:  []string{"personality"},
+				Action: "SCMP_ACT_ALLOW",
+				Args:   []Arg{{Index: 0, Value: value, ValueTwo: valueTwo, Op: op}},
+			}},
+		}
+		prog, err := p.Compile(func(string) bool { return false })
+		if err != nil {
+			t.Fatalf("Compile %s: %v", op, err)
+		}
+		return prog
+	}
+
+	const big = 1<<32 + 5
+	tests := []struct {
+		op        string
+		value     uint64
+		valueTwo  uint64
+		arg       uint64
+		wantAllow bool
+	}{
+		{"SCMP_CMP_EQ", big, 0, big, true},
+		{"SCMP_CMP_EQ", big, 0, 5, false},
+		{"SCMP_CMP_NE", big, 0, 5, true},
+		{"SCMP_CMP_NE", big, 0, big, false},
+		{"SCMP_CMP_GT", big, 0, big + 1, true},
+		{"SCMP_CMP_GT", big, 0, big, false},
+		{"SCMP_CMP_GT", big, 0, 1 << 33, true},
+		{"SCMP_CMP_GE", big, 0, big, true},
+		{"SCMP_CMP_GE", big, 0, 6, false},
+		{"SCMP_CMP_LT", big, 0, 6, true},
+		{"SCMP_CMP_LT", big, 0, big, false},
+		{"SCMP_CMP_LE", big, 0, big, true},
+		{"SCMP_CMP_LE", big, 0, big + 1, false},
+		{"SCMP_CMP_MASKED_EQ", 0xff00, 0x0800, 0x08ff, true},
+		{"SCMP_CMP_MASKED_EQ", 0xff00, 0x0800, 0x09ff, false},
+	}
+	for _, tt := range tests {
+		got := run(t, rule(tt.op, tt.value, tt.valueTwo), nativeArch, nr, tt.arg)
+		if (got == unix.SECCOMP_RET_ALLOW) != tt.wantAllow {
+			t.Errorf("%s(%#x, %#x) on %#x: got %#x, want allow=%v", tt.op, tt.value, tt.valueTwo, tt.arg, got, tt.wantAllow)
+		}
+	}
+}
+
+func TestCompile_CapFilters(t *testing.T) {
+	p, err := Load(&config.Seccomp{})
+	if err != nil {
+		t.Fatalf("Load default: %v", err)
+	}
+	mount := syscallNumbers["mount"]
+
+	for _, admin := range []bool{false, true} {
+		prog, err := p.Compile(func(c string) bool { return admin && c == "CAP_SYS_ADMIN" })
+		if err != nil {
+			t.Fatalf("Compile: %v", err)
+		}
+		got := run(t, prog, nativeArch, mount)
+		if want := admin; (got == unix.SECCOMP_RET_ALLOW) != want {
+			t.Errorf("mount with CAP_SYS_ADMIN=%v: got %#x", admin, got)
+		}
+		if got := run(t, prog, nativeArch, syscallNumbers["reboot"]); got != unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM) {
+			t.Errorf("reboot: got %#x, want EPERM", got)
+		}
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := map[string]string{
+		"bad action": `{"defaultAction": "SCMP_ACT_NOTIFY"}`,
+		"bad op":     `{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ERRNO", "args": [{"index": 0, "value": 1, "op": "SCMP_CMP_XOR"}]}]}`,
+		"bad index":  `{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ERRNO", "args": [{"index": 6, "value": 1, "op": "SCMP_CMP_EQ"}]}]}`,
+		"bad arch":   `{"defaultAction": "SCMP_ACT_ALLOW", "architectures": ["SCMP_ARCH_PPC64LE"]}`,
+	}
+	for name, profile := range tests {
+		p, err := Load(&config.Seccomp{Profile: json.RawMessage(profile)})
+		if err != nil {
+			t.Fatalf("%s: Load: %v", name, err)
+		}
+		if _, err := p.Compile(func(string) bool { return true }); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	if v := parseVersion("6.1.102-fc"); v != [2]int{6, 1} {
+		t.Errorf("parseVersion: got %v", v)
+	}
+	if !atLeast([2]int{5, 10}, "4.8") || atLeast([2]int{5, 10}, "5.11") {
+		t.Error("atLeast: wrong comparison")
+	}
+}
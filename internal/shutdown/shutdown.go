@@ -9,13 +9,18 @@ import (
 	"golang.org/x/sys/unix"
 
 	"github.com/pigeon-as/pigeon-init/internal/config"
+	"github.com/pigeon-as/pigeon-init/internal/swap"
 )
 
 const exitCodeRebootFailed = 1
 
-func Shutdown(mounts []config.Mount, logger *slog.Logger) {
+// Shutdown deactivates swap, unmounts mounts in reverse order, syncs and
+// reboots.
+func Shutdown(mounts []string, swaps []string, logger *slog.Logger) {
+	swap.Disable(swaps, logger)
+
 	for i := len(mounts) - 1; i >= 0; i-- {
-		unmountWithRetry(mounts[i].MountPath, logger)
+		unmountWithRetry(mounts[i], logger)
 	}
 
 	unix.Sync()
@@ -0,0 +1,243 @@
+package swap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+// swapon flags (include/linux/swap.h).
+const (
+	swapFlagPrefer   = 0x8000
+	swapFlagPrioMask = 0x7fff
+)
+
+const (
+	signature       = "SWAPSPACE2"
+	zramDevice      = "zram0"
+	defaultZramPrio = 100
+)
+
+var sysBlock = "/sys/block"
+
+// Enable sets up and activates the configured swap areas: zram first (at a
+// higher priority by default), then files and partitions. Returns the paths
+// that were activated so they can be passed to Disable.
+func Enable(cfg *config.Swap, logger *slog.Logger) ([]string, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	var active []string
+
+	if z := cfg.Zram; z != nil {
+		dev, err := setupZram(z)
+		if err != nil {
+			return active, fmt.Errorf("zram: %w", err)
+		}
+		prio := z.Priority
+		if prio == 0 {
+			prio = defaultZramPrio
+		}
+		if err := activate(dev, prio); err != nil {
+			return active, err
+		}
+		active = append(active, dev)
+		logger.Info("swap enabled", "path", dev, "size", z.Size, "algorithm", z.Algorithm)
+	}
+
+	for _, d := range cfg.Devices {
+		if err := prepare(d); err != nil {
+			return active, err
+		}
+		if err := activate(d.Path, d.Priority); err != nil {
+			return active, err
+		}
+		active = append(active, d.Path)
+		logger.Info("swap enabled", "path", d.Path)
+	}
+	return active, nil
+}
+
+// Disable deactivates swap areas in reverse order.
+func Disable(paths []string, logger *slog.Logger) {
+	for i := len(paths) - 1; i >= 0; i-- {
+		if err := swapoff(paths[i]); err != nil {
+			logger.Warn("swapoff failed", "path", paths[i], "err", err)
+		}
+	}
+}
+
+func setupZram(z *config.Zram) (string, error) {
+	if z.Size <= 0 {
+		return "", fmt.Errorf("size must be positive")
+	}
+	dir := filepath.Join(sysBlock, zramDevice)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("%s not available (zram module loaded?): %w", dir, err)
+	}
+	// The algorithm must be set before disksize initialises the device.
+	if z.Algorithm != "" {
+		if err := os.WriteFile(filepath.Join(dir, "comp_algorithm"), []byte(z.Algorithm), 0644); err != nil {
+			return "", fmt.Errorf("set algorithm %s: %w", z.Algorithm, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "disksize"), []byte(strconv.FormatInt(z.Size, 10)), 0644); err != nil {
+		return "", fmt.Errorf("set disksize: %w", err)
+	}
+	dev := "/dev/" + zramDevice
+	if err := mkswap(dev, z.Size); err != nil {
+		return "", err
+	}
+	return dev, nil
+}
+
+// prepare creates and formats a missing swap file of d.Size bytes. An
+// existing file or partition without a swap signature is only formatted
+// with d.Format, so a mistyped path can't wipe a filesystem.
+func prepare(d config.SwapDevice) error {
+	info, err := os.Stat(d.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if d.Size <= 0 {
+			return fmt.Errorf("swap file %s missing and no size given", d.Path)
+		}
+		if err := createFile(d.Path, d.Size); err != nil {
+			return err
+		}
+		return mkswap(d.Path, d.Size)
+	case err != nil:
+		return err
+	}
+
+	ok, err := hasSignature(d.Path)
+	if err != nil || ok {
+		return err
+	}
+	if !d.Format {
+		return fmt.Errorf("%s has no swap signature (set Format to format it)", d.Path)
+	}
+	size := info.Size()
+	if info.Mode()&os.ModeDevice != 0 {
+		if size, err = deviceSize(d.Path); err != nil {
+			return err
+		}
+	}
+	return mkswap(d.Path, size)
+}
+
+func createFile(path string, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	defer f.Close()
+	// Swap files must not have holes.
+	if err := unix.Fallocate(int(f.Fd()), 0, 0, size); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("fallocate %s: %w", path, err)
+	}
+	return nil
+}
+
+func deviceSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("size of %s: %w", path, err)
+	}
+	return size, nil
+}
+
+// mkswap writes a version 1 swap header covering size bytes.
+func mkswap(path string, size int64) error {
+	hdr := header(os.Getpagesize(), size)
+	if hdr == nil {
+		return fmt.Errorf("%s too small for swap", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(hdr, 0); err != nil {
+		f.Close()
+		return fmt.Errorf("write swap header to %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// header builds the first page of a swap area: union swap_header with
+// version 1 info at offset 1024 and the signature in the last 10 bytes.
+func header(pageSize int, size int64) []byte {
+	pages := size / int64(pageSize)
+	if pages < 10 {
+		return nil
+	}
+	hdr := make([]byte, pageSize)
+	binary.NativeEndian.PutUint32(hdr[1024:], 1)               // version
+	binary.NativeEndian.PutUint32(hdr[1028:], uint32(pages-1)) // last_page
+	binary.NativeEndian.PutUint32(hdr[1032:], 0)               // nr_badpages
+	copy(hdr[pageSize-len(signature):], signature)
+	return hdr
+}
+
+func hasSignature(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	pageSize := os.Getpagesize()
+	buf := make([]byte, len(signature))
+	if _, err := f.ReadAt(buf, int64(pageSize-len(signature))); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(buf, []byte(signature)), nil
+}
+
+func activate(path string, prio int) error {
+	flags := 0
+	if prio > 0 {
+		flags = swapFlagPrefer | (prio & swapFlagPrioMask)
+	}
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SWAPON, uintptr(unsafe.Pointer(p)), uintptr(flags), 0); errno != 0 {
+		return fmt.Errorf("swapon %s: %w", path, errno)
+	}
+	return nil
+}
+
+func swapoff(path string) error {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SWAPOFF, uintptr(unsafe.Pointer(p)), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package swap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pigeon-as/pigeon-init/internal/config"
+)
+
+func TestHeader(t *testing.T) {
+	hdr := header(4096, 1<<20)
+	if len(hdr) != 4096 {
+		t.Fatalf("header length: got %d, want 4096", len(hdr))
+	}
+	if got := string(hdr[4096-10:]); got != "SWAPSPACE2" {
+		t.Errorf("signature: got %q", got)
+	}
+	if v := binary.NativeEndian.Uint32(hdr[1024:]); v != 1 {
+		t.Errorf("version: got %d, want 1", v)
+	}
+	if last := binary.NativeEndian.Uint32(hdr[1028:]); last != 255 {
+		t.Errorf("last_page: got %d, want 255", last)
+	}
+}
+
+func TestHeader_TooSmall(t *testing.T) {
+	if header(4096, 4096*5) != nil {
+		t.Error("header for 5 pages: expected nil")
+	}
+}
+
+func TestPrepare_CreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swap", "swapfile")
+
+	if err := prepare(config.SwapDevice{Path: path, Size: 1 << 20}); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size() != 1<<20 || info.Mode().Perm() != 0600 {
+		t.Errorf("swap file: size=%d mode=%v", info.Size(), info.Mode().Perm())
+	}
+	if ok, _ := hasSignature(path); !ok {
+		t.Error("swap file missing signature")
+	}
+}
+
+func TestPrepare_RefusesUnsignedTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	content := bytes.Repeat([]byte("filesystem"), 1<<17)
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := prepare(config.SwapDevice{Path: path}); err == nil {
+		t.Error("prepare unsigned file without Format: expected error")
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, content) {
+		t.Error("unsigned file was modified")
+	}
+}
+
+func TestPrepare_KeepsExistingHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swapfile")
+	if err := os.WriteFile(path, make([]byte, 1<<20), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := prepare(config.SwapDevice{Path: path, Format: true}); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if ok, _ := hasSignature(path); !ok {
+		t.Fatal("existing file should be formatted")
+	}
+	if err := prepare(config.SwapDevice{Path: path}); err != nil {
+		t.Errorf("prepare formatted file: %v", err)
+	}
+}
+
+func TestPrepare_MissingWithoutSize(t *testing.T) {
+	if err := prepare(config.SwapDevice{Path: filepath.Join(t.TempDir(), "nope")}); err == nil {
+		t.Error("prepare missing file without size: expected error")
+	}
+}
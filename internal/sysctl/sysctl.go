@@ -0,0 +1,103 @@
+package sysctl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var procSys = "/proc/sys"
+
+// Policy decides which keys may be set. Entries are dotted keys and cover
+// their subtrees; Deny wins over Allow.
+type Policy struct {
+	Allow []string
+	Deny  []string
+}
+
+// DefaultPolicy allows the namespaced and tuning trees. The denied keys
+// would hand root code execution to whoever controls the value or
+// interfere with init's own boot and shutdown path.
+var DefaultPolicy = Policy{
+	Allow: []string{"fs", "kernel", "net", "user", "vm"},
+	Deny: []string{
+		"kernel.core_pattern",
+		"kernel.hotplug",
+		"kernel.modprobe",
+		"kernel.modules_disabled",
+		"kernel.panic",
+		"kernel.poweroff_cmd",
+		"kernel.usermodehelper",
+		"fs.binfmt_misc",
+	},
+}
+
+// Apply writes each sysctl under /proc/sys in key order. Keys may use dots
+// ("net.ipv4.ip_forward") or slashes ("net/ipv4/conf/eth0.1/rp_filter").
+// Failures, including keys the policy rejects, are returned per key; other
+// keys are still applied.
+func Apply(sysctls map[string]string, policy Policy) map[string]error {
+	keys := make([]string, 0, len(sysctls))
+	for k := range sysctls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	failed := make(map[string]error)
+	for _, k := range keys {
+		if err := set(k, sysctls[k], policy); err != nil {
+			failed[k] = err
+		}
+	}
+	return failed
+}
+
+func set(key, value string, policy Policy) error {
+	name, rel, err := resolve(key)
+	if err != nil {
+		return err
+	}
+	if !policy.permits(name) {
+		return fmt.Errorf("sysctl %s not permitted", name)
+	}
+	path := filepath.Join(procSys, rel)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	if _, err := f.WriteString(value); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// resolve returns the dotted name of key and its path relative to
+// /proc/sys, rejecting anything that would escape it.
+func resolve(key string) (string, string, error) {
+	rel := key
+	if !strings.Contains(key, "/") {
+		rel = strings.ReplaceAll(key, ".", "/")
+	}
+	clean := filepath.Clean("/" + rel)
+	if key == "" || clean == "/" || clean[1:] != strings.Trim(rel, "/") {
+		return "", "", fmt.Errorf("invalid sysctl %q", key)
+	}
+	return strings.ReplaceAll(clean[1:], "/", "."), clean[1:], nil
+}
+
+func (p Policy) permits(name string) bool {
+	return !covered(name, p.Deny) && covered(name, p.Allow)
+}
+
+// covered reports whether name is one of keys or under one of them.
+func covered(name string, keys []string) bool {
+	for _, k := range keys {
+		if name == k || strings.HasPrefix(name, k+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package sysctl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func withProcSys(t *testing.T, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("0"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orig := procSys
+	procSys = dir
+	t.Cleanup(func() { procSys = orig })
+	return dir
+}
+
+func TestApply_DottedAndSlashedKeys(t *testing.T) {
+	dir := withProcSys(t, "net/ipv4/ip_forward", "net/ipv4/conf/eth0.1/rp_filter")
+
+	failed := Apply(map[string]string{
+		"net.ipv4.ip_forward":            "1",
+		"net/ipv4/conf/eth0.1/rp_filter": "2",
+	}, DefaultPolicy)
+	if len(failed) != 0 {
+		t.Fatalf("Apply: %v", failed)
+	}
+
+	for path, want := range map[string]string{
+		"net/ipv4/ip_forward":            "1",
+		"net/ipv4/conf/eth0.1/rp_filter": "2",
+	} {
+		got, _ := os.ReadFile(filepath.Join(dir, path))
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestApply_ReportsPerKey(t *testing.T) {
+	dir := withProcSys(t, "vm/swappiness")
+
+	failed := Apply(map[string]string{
+		"vm.swappiness":       "10",
+		"vm.missing":          "1",
+		"kernel.core_pattern": "|/tmp/x",
+		"debug.exception":     "1",
+	}, DefaultPolicy)
+	if len(failed) != 3 {
+		t.Errorf("failed: got %v, want 3 entries", failed)
+	}
+	for _, k := range []string{"vm.missing", "kernel.core_pattern", "debug.exception"} {
+		if failed[k] == nil {
+			t.Errorf("%s: expected failure", k)
+		}
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "vm/swappiness"))
+	if string(got) != "10" {
+		t.Errorf("vm.swappiness: got %q, want 10", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		key  string
+		name string
+		rel  string
+		ok   bool
+	}{
+		{"vm.swappiness", "vm.swappiness", "vm/swappiness", true},
+		{"/net/core/somaxconn", "net.core.somaxconn", "net/core/somaxconn", true},
+		{"net/../../etc/passwd", "", "", false},
+		{"net..ipv4", "", "", false},
+		{"", "", "", false},
+		{"/", "", "", false},
+	}
+	for _, tt := range tests {
+		name, rel, err := resolve(tt.key)
+		if (err == nil) != tt.ok || name != tt.name || rel != tt.rel {
+			t.Errorf("resolve(%q) = (%q, %q, %v), want (%q, %q, ok=%v)",
+				tt.key, name, rel, err, tt.name, tt.rel, tt.ok)
+		}
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"net.core.somaxconn", true},
+		{"vm.overcommit_memory", true},
+		{"kernel.shmmax", true},
+		{"kernel.modprobe", false},
+		{"kernel.panic", false},
+		{"kernel.panic_on_oops", true},
+		{"fs.binfmt_misc.status", false},
+		{"debug.exception-trace", false},
+		{"dev.raid.speed_limit_min", false},
+	}
+	for _, tt := range tests {
+		if got := DefaultPolicy.permits(tt.name); got != tt.want {
+			t.Errorf("permits(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Custom(t *testing.T) {
+	p := Policy{Allow: []string{"net.ipv4", "kernel.panic"}, Deny: []string{"net.ipv4.conf"}}
+	for name, want := range map[string]bool{
+		"net.ipv4.ip_forward":         true,
+		"net.ipv4.conf.all.rp_filter": false,
+		"net.core.somaxconn":          false,
+		"kernel.panic":                true,
+		"kernel.panic_on_oops":        false,
+	} {
+		if got := p.permits(name); got != want {
+			t.Errorf("permits(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
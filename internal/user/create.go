@@ -0,0 +1,177 @@
+package user
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// homeBase is the parent of synthesized home directories.
+var homeBase = "/home"
+
+// firstFreeID is where allocation of IDs for named users and groups starts.
+const firstFreeID = 1000
+
+// Ensure adds /etc/passwd and /etc/group entries for the user and group in
+// "user[:group]" when the image lacks them, and creates the new user's home
+// directory. Numeric IDs keep their value and get a "user<id>" or
+// "group<id>" name; new names get the first free ID from 1000. The primary
+// group of a new user without an explicit group is a group of the same name.
+// Existing entries are left untouched.
+func Ensure(spec string) error {
+	if spec == "" || spec == "root" {
+		return nil
+	}
+	userPart, groupPart := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		userPart = spec[:i]
+		groupPart = spec[i+1:]
+	}
+
+	gid, gidKnown := uint32(0), false
+	if groupPart != "" {
+		g, err := ensureGroup(groupPart, "")
+		if err != nil {
+			return err
+		}
+		gid, gidKnown = g, true
+	}
+
+	if userName(userPart) != "" || userPart == "root" {
+		return nil
+	}
+
+	var uid uint32
+	name := userPart
+	if n, err := strconv.ParseUint(userPart, 10, 32); err == nil {
+		uid = uint32(n)
+		name = fmt.Sprintf("user%d", uid)
+	} else {
+		if !validName(name) {
+			return fmt.Errorf("invalid user name %q", name)
+		}
+		uid = freeID(func(id uint32) bool {
+			_, ok := findPasswdByUID(id)
+			return ok
+		})
+	}
+
+	if !gidKnown {
+		g, err := ensureGroup(name, strconv.FormatUint(uint64(uid), 10))
+		if err != nil {
+			return err
+		}
+		gid = g
+	}
+
+	home := filepath.Join(homeBase, name)
+	line := fmt.Sprintf("%s:x:%d:%d::%s:%s\n", name, uid, gid, home, loginShell())
+	if err := appendLine("/etc/passwd", line); err != nil {
+		return fmt.Errorf("add user %s: %w", name, err)
+	}
+	if err := makeHome(home, uid, gid); err != nil {
+		return fmt.Errorf("create home %s: %w", home, err)
+	}
+	return nil
+}
+
+// ensureGroup returns the GID of the group name (a name or GID), adding it
+// to /etc/group if missing. A new named group prefers the GID preferred,
+// if free.
+func ensureGroup(name, preferred string) (uint32, error) {
+	if n, err := strconv.ParseUint(name, 10, 32); err == nil {
+		gid := uint32(n)
+		if groupExists(gid) {
+			return gid, nil
+		}
+		return gid, addGroup(fmt.Sprintf("group%d", gid), gid)
+	}
+	if gid, ok := findGroupByName(name); ok {
+		return gid, nil
+	}
+	if !validName(name) {
+		return 0, fmt.Errorf("invalid group name %q", name)
+	}
+
+	var gid uint32
+	if n, err := strconv.ParseUint(preferred, 10, 32); err == nil && !groupExists(uint32(n)) {
+		gid = uint32(n)
+	} else {
+		gid = freeID(groupExists)
+	}
+	return gid, addGroup(name, gid)
+}
+
+func addGroup(name string, gid uint32) error {
+	if err := appendLine("/etc/group", fmt.Sprintf("%s:x:%d:\n", name, gid)); err != nil {
+		return fmt.Errorf("add group %s: %w", name, err)
+	}
+	return nil
+}
+
+func groupExists(gid uint32) bool {
+	found := false
+	scanGroup(func(_ []string, g uint32) bool {
+		found = g == gid
+		return found
+	})
+	return found
+}
+
+func freeID(taken func(uint32) bool) uint32 {
+	id := uint32(firstFreeID)
+	for taken(id) {
+		id++
+	}
+	return id
+}
+
+// validName rejects names that would corrupt passwd or group files.
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ":,\n\r\t /")
+}
+
+func loginShell() string {
+	if _, err := os.Stat("/bin/sh"); err == nil {
+		return "/bin/sh"
+	}
+	return "/sbin/nologin"
+}
+
+// appendLine appends line to path, creating it if needed and starting on a
+// new line if the file doesn't end with one.
+func appendLine(path, line string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		line = "\n" + line
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// makeHome creates home with mode 0700 owned by uid:gid. An existing
+// directory is left as is.
+func makeHome(home string, uid, gid uint32) error {
+	if _, err := os.Stat(home); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(home), 0755); err != nil {
+		return err
+	}
+	if err := os.Mkdir(home, 0700); err != nil {
+		return err
+	}
+	return os.Chown(home, int(uid), int(gid))
+}
@@ -11,10 +11,14 @@ import (
 type Identity struct {
 	UID     uint32
 	GID     uint32
+	Groups  []uint32 // supplementary
 	HomeDir string
 }
 
-func Resolve(spec string) (*Identity, error) {
+// Resolve resolves "user[:group]" against /etc/passwd and /etc/group.
+// Supplementary groups are the user's /etc/group memberships plus
+// extraGroups (names or GIDs).
+func Resolve(spec string, extraGroups []string) (*Identity, error) {
 	if spec == "" {
 		spec = "root"
 	}
@@ -38,7 +42,42 @@ func Resolve(spec string) (*Identity, error) {
 		gid = resolvedGID
 	}
 
-	return &Identity{UID: uid, GID: gid, HomeDir: home}, nil
+	groups := memberGroups(userName(userPart))
+	for _, g := range extraGroups {
+		extra, err := lookupGroup(g)
+		if err != nil {
+			return nil, fmt.Errorf("resolve supplementary group %q: %w", g, err)
+		}
+		groups = append(groups, extra)
+	}
+
+	return &Identity{UID: uid, GID: gid, Groups: dedupe(groups), HomeDir: home}, nil
+}
+
+// userName returns the passwd name for a user name or numeric UID, or ""
+// if the user has no passwd entry.
+func userName(name string) string {
+	if entry, ok := findPasswdByName(name); ok {
+		return entry.name
+	}
+	if uid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		if entry, ok := findPasswdByUID(uint32(uid)); ok {
+			return entry.name
+		}
+	}
+	return ""
+}
+
+func dedupe(gids []uint32) []uint32 {
+	seen := make(map[uint32]bool, len(gids))
+	var out []uint32
+	for _, g := range gids {
+		if !seen[g] {
+			seen[g] = true
+			out = append(out, g)
+		}
+	}
+	return out
 }
 
 func lookupUser(name string) (uint32, uint32, string, error) {
@@ -72,6 +111,7 @@ func lookupGroup(name string) (uint32, error) {
 }
 
 type passwdEntry struct {
+	name string
 	uid  uint32
 	gid  uint32
 	home string
@@ -115,16 +155,51 @@ func scanPasswd(match func([]string) bool) (passwdEntry, bool) {
 				continue
 			}
 			home := fields[5]
-			return passwdEntry{uid: uint32(uid), gid: uint32(gid), home: home}, true
+			return passwdEntry{name: fields[0], uid: uint32(uid), gid: uint32(gid), home: home}, true
 		}
 	}
 	return passwdEntry{}, false
 }
 
 func findGroupByName(name string) (uint32, bool) {
+	var gid uint32
+	found := false
+	scanGroup(func(fields []string, g uint32) bool {
+		if fields[0] == name {
+			gid, found = g, true
+			return true
+		}
+		return false
+	})
+	return gid, found
+}
+
+// memberGroups returns the GIDs of groups listing name as a member.
+func memberGroups(name string) []uint32 {
+	if name == "" {
+		return nil
+	}
+	var gids []uint32
+	scanGroup(func(fields []string, gid uint32) bool {
+		if len(fields) < 4 {
+			return false
+		}
+		for _, m := range strings.Split(fields[3], ",") {
+			if strings.TrimSpace(m) == name {
+				gids = append(gids, gid)
+				break
+			}
+		}
+		return false
+	})
+	return gids
+}
+
+// scanGroup calls fn for each valid /etc/group line until it returns true.
+func scanGroup(fn func(fields []string, gid uint32) bool) {
 	f, err := os.Open("/etc/group")
 	if err != nil {
-		return 0, false
+		return
 	}
 	defer f.Close()
 
@@ -138,13 +213,12 @@ func findGroupByName(name string) (uint32, bool) {
 		if len(fields) < 3 {
 			continue
 		}
-		if fields[0] == name {
-			gid, err := strconv.ParseUint(fields[2], 10, 32)
-			if err != nil {
-				continue
-			}
-			return uint32(gid), true
+		gid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		if fn(fields, uint32(gid)) {
+			return
 		}
 	}
-	return 0, false
 }
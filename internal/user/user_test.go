@@ -3,6 +3,7 @@ package user
 import (
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 )
 
@@ -135,6 +136,47 @@ func TestScanPasswd_BadUID(t *testing.T) {
 	}
 }
 
+func TestMemberGroups(t *testing.T) {
+	writeTestGroup(t, "app:x:1000:\ndocker:x:999:app,other\nvideo:x:44:other, app\nstaff:x:50:\n")
+
+	got := memberGroups("app")
+	if len(got) != 2 || got[0] != 999 || got[1] != 44 {
+		t.Errorf("memberGroups(app): got %v, want [999 44]", got)
+	}
+	if got := memberGroups(""); got != nil {
+		t.Errorf("memberGroups(empty): got %v, want nil", got)
+	}
+}
+
+func TestResolve_SupplementaryGroups(t *testing.T) {
+	writeTestPasswd(t, "app:x:1000:1000::/home/app:/bin/sh\n")
+	writeTestGroup(t, "app:x:1000:\ndocker:x:999:app\nstaff:x:50:\n")
+
+	id, err := Resolve("1000", []string{"staff", "999", "7"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := []uint32{999, 50, 7}
+	if len(id.Groups) != len(want) {
+		t.Fatalf("Groups: got %v, want %v", id.Groups, want)
+	}
+	for i := range want {
+		if id.Groups[i] != want[i] {
+			t.Errorf("Groups: got %v, want %v", id.Groups, want)
+			break
+		}
+	}
+}
+
+func TestResolve_UnknownExtraGroup(t *testing.T) {
+	writeTestPasswd(t, "app:x:1000:1000::/home/app:/bin/sh\n")
+	writeTestGroup(t, "app:x:1000:\n")
+
+	if _, err := Resolve("app", []string{"nonexistent"}); err == nil {
+		t.Error("Resolve with unknown extra group: expected error")
+	}
+}
+
 // writeTestPasswd writes content to /etc/passwd (or skips if not root).
 func writeTestPasswd(t *testing.T, content string) {
 	t.Helper()
@@ -172,3 +214,86 @@ func writeTestFile(t *testing.T, path, content string) {
 		t.Skipf("cannot write %s (need root): %v", path, err)
 	}
 }
+
+func TestEnsure_NumericUID(t *testing.T) {
+	writeTestPasswd(t, "root:x:0:0:Root:/root:/bin/bash\n")
+	writeTestGroup(t, "root:x:0:\n")
+	homeBase = t.TempDir()
+	t.Cleanup(func() { homeBase = "/home" })
+
+	if err := Ensure("4242"); err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	id, err := Resolve("4242", nil)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	home := filepath.Join(homeBase, "user4242")
+	if id.UID != 4242 || id.GID != 4242 || id.HomeDir != home {
+		t.Errorf("got uid=%d gid=%d home=%q", id.UID, id.GID, id.HomeDir)
+	}
+	if gid, ok := findGroupByName("user4242"); !ok || gid != 4242 {
+		t.Errorf("group user4242: got %d, %v", gid, ok)
+	}
+	st, err := os.Stat(home)
+	if err != nil {
+		t.Fatalf("stat home: %v", err)
+	}
+	if st.Mode().Perm() != 0700 || st.Sys().(*syscall.Stat_t).Uid != 4242 {
+		t.Errorf("home: mode %o uid %d", st.Mode().Perm(), st.Sys().(*syscall.Stat_t).Uid)
+	}
+
+	// A second call leaves the files alone.
+	before, _ := os.ReadFile("/etc/passwd")
+	if err := Ensure("4242"); err != nil {
+		t.Fatalf("Ensure again: %v", err)
+	}
+	if after, _ := os.ReadFile("/etc/passwd"); string(after) != string(before) {
+		t.Errorf("second Ensure changed /etc/passwd:\n%s", after)
+	}
+}
+
+func TestEnsure_NameAndGroup(t *testing.T) {
+	writeTestPasswd(t, "root:x:0:0:Root:/root:/bin/bash\napp:x:1000:1000::/home/app:/bin/sh")
+	writeTestGroup(t, "root:x:0:\napp:x:1000:\n")
+	homeBase = t.TempDir()
+	t.Cleanup(func() { homeBase = "/home" })
+
+	if err := Ensure("worker:jobs"); err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	id, err := Resolve("worker:jobs", nil)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if id.UID != 1001 || id.GID != 1001 {
+		t.Errorf("got uid=%d gid=%d, want 1001:1001", id.UID, id.GID)
+	}
+	if _, ok := findGroupByName("worker"); ok {
+		t.Error("Ensure added a group named after the user despite an explicit group")
+	}
+}
+
+func TestEnsure_ExistingUserUnknownGroup(t *testing.T) {
+	writeTestPasswd(t, "app:x:1000:1000::/home/app:/bin/sh\n")
+	writeTestGroup(t, "app:x:1000:\n")
+
+	if err := Ensure("app:5000"); err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	if gid, ok := findGroupByName("group5000"); !ok || gid != 5000 {
+		t.Errorf("group5000: got %d, %v", gid, ok)
+	}
+	if entry, _ := findPasswdByName("app"); entry.home != "/home/app" {
+		t.Errorf("existing user changed: %+v", entry)
+	}
+}
+
+func TestEnsure_InvalidName(t *testing.T) {
+	writeTestPasswd(t, "")
+	writeTestGroup(t, "")
+
+	if err := Ensure("bad:name:x"); err == nil {
+		t.Error("expected error for group name with a colon")
+	}
+}